@@ -1,29 +1,83 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/derek-elliott/url-shortener/audit"
 	"github.com/derek-elliott/url-shortener/cache"
 	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/geoip"
+	"github.com/derek-elliott/url-shortener/leader"
+	"github.com/derek-elliott/url-shortener/metrics"
+	"github.com/derek-elliott/url-shortener/ratelimit"
+	"github.com/derek-elliott/url-shortener/targeting"
+	"github.com/derek-elliott/url-shortener/tracing"
+	"github.com/derek-elliott/url-shortener/webhook"
 	"github.com/gorilla/mux"
 	// Blank import for Postgres support
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	log "github.com/sirupsen/logrus"
 )
 
-const tokenLength = 6
+const (
+	tokenLength            = 6
+	defaultSweepInterval   = 30 * time.Second
+	defaultSweepBatchSize  = 500
+	defaultTrashRetention  = 30 * 24 * time.Hour
+	defaultTombstoneTTL    = 30 * 24 * time.Hour
+	maxTokenAttempts       = 5
+	defaultShutdownTimeout = 15 * time.Second
+	defaultMetricsPath     = "/metrics"
+	defaultRedirectType    = http.StatusFound
+	fallbackCacheTTL       = time.Hour
+	defaultQueryPrecedence = PrecedenceLink
+)
 
 // App holds the router, db and cache connections
 type App struct {
-	Router   *mux.Router
-	DB       db.Store
-	Cache    cache.Cache
-	Hostname string
+	Router          *mux.Router
+	DB              db.Store
+	Cache           cache.Cache
+	Hostname        string
+	RedirectType    int
+	QueryPrecedence string
+	GeoIP           geoip.Locator
+	Interstitial    Interstitial
+	SigningKey      []byte
+	Templates       *template.Template
+	SweepInterval   time.Duration
+	SweepBatchSize  int
+	TombstoneTTL    time.Duration
+	AuditSink       audit.Sink
+	WebhookClient   *http.Client
+	WebhookInterval time.Duration
+	ClickMilestones []int
+	TrashRetention  time.Duration
+	Leader          *leader.Monitor
+	AccessLog       *AccessLog
+	RateLimiter     ratelimit.Limiter
+	RateLimits      map[string]ratelimit.Policy
+	Accounts        map[string]Account
+	TrustedProxies  []*net.IPNet
+	DefaultQuota    Quota
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	MetricsAddress  string
+	MetricsPath     string
+	domains         interstitialDomains
+	pending         sync.WaitGroup
+	draining        int32
 }
 
 // Route holds all the information about a route registered with our service.
@@ -37,27 +91,54 @@ type Route struct {
 // Routes holds a list of Routes
 type Routes []Route
 
+// Job holds a periodic background task that only runs on the leader.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context)
+}
+
+// Jobs holds a list of Jobs
+type Jobs []Job
+
 // RegisterPayload represents a payload to register a URL with our shortener.
 type RegisterPayload struct {
-	URL string `json:"url"`
-	TTL string `json:"ttl"`
+	URL             string             `json:"url"`
+	TTL             string             `json:"ttl"`
+	RedirectType    int                `json:"redirect_type"`
+	Passthrough     bool               `json:"passthrough"`
+	QueryPrecedence string             `json:"query_precedence"`
+	UTM             db.UTM             `json:"utm"`
+	Rules           targeting.Rules    `json:"rules"`
+	Variants        targeting.Variants `json:"variants"`
+	Interstitial    bool               `json:"interstitial"`
+	Activation      string             `json:"activation"`
+	FallbackURL     string             `json:"fallback_url"`
+	Folder          string             `json:"folder"`
+	Tags            []string           `json:"tags"`
 }
 
 // InitRouter initializes the router
 func (a *App) InitRouter() {
 	routes := Routes{
+		Route{
+			"Healthz",
+			"GET",
+			"/healthz",
+			a.Healthz,
+		},
+		Route{
+			"Readyz",
+			"GET",
+			"/readyz",
+			a.Readyz,
+		},
 		Route{
 			"Register",
 			"POST",
 			"/",
 			a.RegisterShortener,
 		},
-		Route{
-			"Redirect",
-			"GET",
-			"/{token}",
-			a.RedirectToURL,
-		},
 		Route{
 			"Stats",
 			"GET",
@@ -71,10 +152,136 @@ func (a *App) InitRouter() {
 			a.GetURLStats,
 		},
 		Route{
-			"DeleteAll",
+			"Usage",
+			"GET",
+			"/api/v1/usage",
+			a.GetUsage,
+		},
+		Route{
+			"Audit",
+			"GET",
+			"/api/v1/audit",
+			a.ListAudit,
+		},
+		Route{
+			"ListLinks",
+			"GET",
+			"/api/v1/links",
+			a.ListLinks,
+		},
+		Route{
+			"ListTags",
+			"GET",
+			"/api/v1/tags",
+			a.ListTags,
+		},
+		Route{
+			"RenameTag",
+			"PATCH",
+			"/api/v1/tags/{tag}",
+			a.RenameTag,
+		},
+		Route{
+			"DeleteTag",
+			"DELETE",
+			"/api/v1/tags/{tag}",
+			a.DeleteTag,
+		},
+		Route{
+			"ListFolders",
+			"GET",
+			"/api/v1/folders",
+			a.ListFolders,
+		},
+		Route{
+			"ListInterstitialDomains",
+			"GET",
+			"/api/v1/interstitial/domains",
+			a.ListInterstitialDomains,
+		},
+		Route{
+			"AddInterstitialDomain",
+			"PUT",
+			"/api/v1/interstitial/domains/{domain}",
+			a.AddInterstitialDomain,
+		},
+		Route{
+			"DeleteInterstitialDomain",
+			"DELETE",
+			"/api/v1/interstitial/domains/{domain}",
+			a.DeleteInterstitialDomain,
+		},
+		Route{
+			"ListWebhooks",
+			"GET",
+			"/api/v1/webhooks",
+			a.ListWebhooks,
+		},
+		Route{
+			"CreateWebhook",
+			"POST",
+			"/api/v1/webhooks",
+			a.CreateWebhook,
+		},
+		Route{
+			"DeleteWebhook",
+			"DELETE",
+			"/api/v1/webhooks/{id:[0-9]+}",
+			a.DeleteWebhook,
+		},
+		Route{
+			"ListDeliveries",
+			"GET",
+			"/api/v1/webhooks/{id:[0-9]+}/deliveries",
+			a.ListDeliveries,
+		},
+		Route{
+			"ListTrash",
+			"GET",
+			"/api/v1/trash",
+			a.ListTrash,
+		},
+		Route{
+			"RestoreAll",
+			"POST",
+			"/api/v1/trash/restore",
+			a.RestoreURLs,
+		},
+		Route{
+			"Restore",
+			"POST",
+			"/api/v1/trash/{token}/restore",
+			a.RestoreURL,
+		},
+		Route{
+			"Preview",
+			"GET",
+			"/{token:[^/]+}+",
+			a.PreviewURL,
+		},
+		Route{
+			"Redirect",
+			"GET",
+			"/{token}{path:(?:/.*)?}",
+			a.RedirectToURL,
+		},
+		Route{
+			"BulkDelete",
 			"DELETE",
 			"/",
-			a.DeleteAll,
+			a.BulkDelete,
+		},
+		Route{
+			"UpdateURL",
+			"PATCH",
+			"/{token}",
+			a.UpdateURL,
+		},
+		Route{
+			"SetStatus",
+			"PUT",
+			"/{token}/status",
+			a.SetLinkStatus,
 		},
 		Route{
 			"DeleteURL",
@@ -84,6 +291,17 @@ func (a *App) InitRouter() {
 		},
 	}
 
+	if a.MetricsAddress == "" {
+		routes = append(Routes{
+			Route{
+				"Metrics",
+				"GET",
+				a.metricsPath(),
+				metrics.Handler().ServeHTTP,
+			},
+		}, routes...)
+	}
+
 	a.Router = mux.NewRouter()
 	for _, route := range routes {
 		a.Router.Methods(route.Method).
@@ -91,67 +309,263 @@ func (a *App) InitRouter() {
 			Name(route.Name).
 			Handler(route.HandlerFunc)
 	}
-	a.Router.Use(Logger)
+	accessLog := a.AccessLog
+	if accessLog == nil {
+		accessLog = &AccessLog{Format: "logfmt"}
+	}
+	a.Router.Use(a.ClientIP, RequestID, Tracing, accessLog.Middleware, Metrics)
+	if a.RateLimiter != nil {
+		a.Router.Use(a.RateLimit)
+	}
+}
+
+// StatusPayload represents a payload to change the status of a shortener
+type StatusPayload struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// URLStats holds a shortener with its redirects broken down by dimension
+type URLStats struct {
+	*db.ShortURL
+	Clicks map[string]map[string]int `json:"clicks"`
+}
+
+// InitJobs lists the periodic background jobs
+func (a *App) InitJobs() Jobs {
+	sweepInterval := a.SweepInterval
+	if sweepInterval <= 0 {
+		sweepInterval = defaultSweepInterval
+	}
+	return Jobs{
+		Job{
+			"CleanExpiredRecords",
+			sweepInterval,
+			a.cleanExpiredRecords,
+		},
+		Job{
+			"PurgeTrash",
+			sweepInterval,
+			a.purgeTrash,
+		},
+		Job{
+			"DeliverWebhooks",
+			a.webhookInterval(),
+			a.deliverWebhooks,
+		},
+	}
 }
 
-// Run runs the application
-func (a *App) Run(port int) error {
+// Run runs the application until the context is cancelled, then drains in-flight
+// requests, stops the background jobs and closes the store and cache
+func (a *App) Run(ctx context.Context, port int) error {
 	a.InitRouter()
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	if a.Leader != nil {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			a.Leader.Run(jobsCtx)
+		}()
+	}
+	jobs.Add(1)
 	go func() {
-		for {
-			a.cleanExpiredRecords()
-			time.Sleep(30 * time.Second)
-		}
+		defer jobs.Done()
+		a.watchInterstitialDomains(jobsCtx)
 	}()
-	bindAddress := fmt.Sprintf(":%d", port)
-	err := http.ListenAndServe(bindAddress, a.Router)
+	for _, job := range a.InitJobs() {
+		jobs.Add(1)
+		go func(job Job) {
+			defer jobs.Done()
+			a.scheduleJob(jobsCtx, job)
+		}(job)
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: a.Router,
+	}
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	var metricsServer *http.Server
+	if a.MetricsAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(a.metricsPath(), metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:    a.MetricsAddress,
+			Handler: metricsMux,
+		}
+		go func() {
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+		timeout := a.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		// Keep serving while /readyz reports not ready, so load balancers stop
+		// sending requests before the listener closes
+		atomic.StoreInt32(&a.draining, 1)
+		if a.DrainDelay > 0 {
+			log.WithField("drain_delay", a.DrainDelay).Info("Shutting down, waiting for load balancers to stop routing here")
+			drain := time.NewTimer(a.DrainDelay)
+			select {
+			case <-drain.C:
+			case <-shutdownCtx.Done():
+				drain.Stop()
+			}
+		}
+		log.Info("Shutting down, draining connections")
+		if err = server.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Error("Unable to drain all connections before the shutdown timeout")
+		}
+		a.flushPending(shutdownCtx)
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
+	stopJobs()
+	jobs.Wait()
+	a.close()
 	return err
 }
 
 // RegisterShortener registeres a shortened url with the service
 func (a *App) RegisterShortener(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
 	var payload RegisterPayload
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.WithError(err).Error("Unable to read request body")
+		logger.WithError(err).Error("Unable to read request body")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 	if err = json.Unmarshal(body, &payload); err != nil {
-		log.WithError(err).Error("Unable to deserialize request body")
+		logger.WithError(err).Error("Unable to deserialize request body")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	duration, err := time.ParseDuration(payload.TTL)
 	if err != nil {
-		log.WithError(err).Error("Unable to parse TTL from request body")
+		logger.WithError(err).Error("Unable to parse TTL from request body")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	shortURL := db.ShortURL{}
 	if _, err = url.ParseRequestURI(payload.URL); err != nil {
-		log.WithField("url", payload.URL).WithError(err).Error("Unable to parse URL from request body")
+		logger.WithField("url", payload.URL).WithError(err).Error("Unable to parse URL from request body")
 		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	redirectType := payload.RedirectType
+	if redirectType == 0 {
+		redirectType = a.redirectType()
+	}
+	if !ValidRedirectType(redirectType) {
+		logger.WithField("redirect_type", payload.RedirectType).Error("Unsupported redirect type in request body")
+		writeError(w, http.StatusBadRequest, "invalid_redirect_type", "redirect_type must be one of 301, 302, 303, 307 or 308")
+		return
+	}
+	if payload.QueryPrecedence != "" && !ValidQueryPrecedence(payload.QueryPrecedence) {
+		logger.WithField("query_precedence", payload.QueryPrecedence).Error("Unsupported query precedence in request body")
+		writeError(w, http.StatusBadRequest, "invalid_query_precedence", "query_precedence must be link or request")
+		return
+	}
+	if err = payload.Rules.Validate(); err != nil {
+		logger.WithError(err).Error("Invalid targeting rules in request body")
+		writeError(w, http.StatusBadRequest, "invalid_rules", err.Error())
+		return
+	}
+	if err = payload.Variants.Validate(); err != nil {
+		logger.WithError(err).Error("Invalid variants in request body")
+		writeError(w, http.StatusBadRequest, "invalid_variants", err.Error())
+		return
+	}
+	if payload.Activation != "" {
+		if _, err = time.Parse(time.RFC3339, payload.Activation); err != nil {
+			logger.WithField("activation", payload.Activation).WithError(err).Error("Unable to parse activation from request body")
+			writeError(w, http.StatusBadRequest, "invalid_activation", "activation must be an RFC 3339 time")
+			return
+		}
+	}
+	if payload.FallbackURL != "" {
+		if _, err = url.ParseRequestURI(payload.FallbackURL); err != nil {
+			logger.WithField("fallback_url", payload.FallbackURL).WithError(err).Error("Unable to parse fallback URL from request body")
+			writeError(w, http.StatusBadRequest, "invalid_fallback_url", "fallback_url must be an absolute URL")
+			return
+		}
+	}
+	if !validFolder(payload.Folder) {
+		writeError(w, http.StatusBadRequest, "invalid_folder", "folder must be at most 100 characters without surrounding spaces")
+		return
 	}
+	tags, err := normalizeTags(payload.Tags)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_tags", err.Error())
+		return
+	}
+	account, ok := a.requestAccount(r)
+	if !ok {
+		writeError(w, http.StatusForbidden, "invalid_api_key", "The API key is not recognized")
+		return
+	}
+	now := time.Now()
+	if quotaErr := checkQuota(account, duration); quotaErr != nil {
+		logger.WithField("owner", account.Owner).WithField("code", quotaErr.code).Info("Registration refused by quota")
+		writeError(w, quotaErr.status, quotaErr.code, quotaErr.message)
+		return
+	}
+	shortURL.Owner = account.Owner
+	shortURL.Status = db.StatusActive
 	shortURL.URL = payload.URL
-	shortURL.Expiration = time.Now().Add(duration).Format(time.RFC3339)
-	shortURL.Token, err = generateToken(tokenLength)
+	shortURL.RedirectType = redirectType
+	shortURL.Passthrough = payload.Passthrough
+	shortURL.QueryPrecedence = payload.QueryPrecedence
+	shortURL.UTM = payload.UTM
+	shortURL.Rules = payload.Rules
+	shortURL.Variants = payload.Variants
+	shortURL.Interstitial = payload.Interstitial
+	shortURL.Activation = payload.Activation
+	shortURL.FallbackURL = payload.FallbackURL
+	shortURL.Folder = payload.Folder
+	shortURL.Tags = tags
+	shortURL.Expiration = now.Add(duration).Format(time.RFC3339)
+	shortURL.Token, err = a.newToken(r.Context())
 	if err != nil {
-		log.WithError(err).Error("Error generating URL token")
+		logger.WithError(err).Error("Error generating URL token")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	shortURL.ShortenedURL = fmt.Sprintf("%s/%s", a.Hostname, shortURL.Token)
 
-	if err = a.DB.CreateShortURL(&shortURL); err != nil {
-		log.WithField("short_url", shortURL).WithError(err).Error("Database Error")
+	if err = a.DB.CreateShortURL(r.Context(), &shortURL, a.quotaClaim(r, account, now), linkEvents(webhook.LinkCreated, linkPayload)); err != nil {
+		if quotaErr := quotaRefusal(err); quotaErr != nil {
+			logger.WithField("owner", account.Owner).WithField("code", quotaErr.code).Info("Registration refused by quota")
+			writeError(w, quotaErr.status, quotaErr.code, quotaErr.message)
+			return
+		}
+		logger.WithField("short_url", shortURL).WithError(err).Error("Database Error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	metrics.LinksCreated.Inc()
+	a.audit(r, AuditCreate, shortURL.Token, nil, &shortURL)
 
-	if err = a.Cache.SetURL(shortURL.Token, shortURL.URL, duration); err != nil {
-		log.WithFields(log.Fields{"token": shortURL.Token, "url": shortURL.URL, "duration": duration}).WithError(err).Error("Cache Error")
+	if err = a.Cache.SetURL(r.Context(), cachedLink(&shortURL), duration); err != nil {
+		logger.WithFields(log.Fields{"token": shortURL.Token, "url": shortURL.URL, "duration": duration}).WithError(err).Error("Cache Error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -159,7 +573,7 @@ func (a *App) RegisterShortener(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err = json.NewEncoder(w).Encode(shortURL); err != nil {
-		log.WithField("response", shortURL).WithError(err).Error("Unable to serialize RegisterShortener response")
+		logger.WithField("response", shortURL).WithError(err).Error("Unable to serialize RegisterShortener response")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -167,30 +581,88 @@ func (a *App) RegisterShortener(w http.ResponseWriter, r *http.Request) {
 
 // RedirectToURL redirects a request to the specified URL
 func (a *App) RedirectToURL(w http.ResponseWriter, r *http.Request) {
-	token := mux.Vars(r)["token"]
-	url, err := a.Cache.GetURL(token)
+	logger := LoggerFromContext(r.Context())
+	if r.URL.Query().Get("preview") == "1" {
+		a.PreviewURL(w, r)
+		return
+	}
+	vars := mux.Vars(r)
+	token := vars["token"]
+	now := time.Now()
+	link, state, err := a.lookupLink(r.Context(), token, now)
+	if err != nil {
+		metrics.Redirects.WithLabelValues("error").Inc()
+		logger.WithField("token", token).WithError(err).Error("Unable to look up link")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if state != "" {
+		metrics.Redirects.WithLabelValues("miss").Inc()
+		a.writeStatus(w, r, state, token)
+		return
+	}
+	if !link.Passthrough && vars["path"] != "" {
+		metrics.Redirects.WithLabelValues("miss").Inc()
+		a.writeStatus(w, r, StateNotFound, token)
+		return
+	}
+	query := r.URL.Query()
+	confirmation := query.Get(continueParam)
+	query.Del(continueParam)
+	client := a.client(r)
+	target, variant := a.target(w, r, link, client)
+	destination, err := a.destination(link, target, query, vars["path"])
 	if err != nil {
-		log.WithField("token", token).WithError(err).Error("Unable to obtain URL from cache")
+		logger.WithField("token", token).WithError(err).Error("Unable to build destination URL")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	go a.incrementRedirects(token)
-	http.Redirect(w, r, url.URL, http.StatusFound)
+	if reason := a.Interstitial.reason(link, destination, a.flaggedDomains()); reason != "" && !a.confirmedContinue(confirmation, token, destination, now) {
+		metrics.Redirects.WithLabelValues("interstitial").Inc()
+		a.renderPage(w, r, http.StatusOK, "warning.html", WarningPage{
+			Token:       token,
+			URL:         destination,
+			Host:        hostOf(destination),
+			Reason:      reason,
+			ContinueURL: a.continueURL(r.URL, token, destination, now),
+		})
+		return
+	}
+	metrics.Redirects.WithLabelValues("hit").Inc()
+	ctx := context.WithoutCancel(r.Context())
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		a.incrementRedirects(ctx, token)
+		a.recordClick(ctx, token, client, variant)
+	}()
+	redirectType := link.RedirectType
+	if redirectType == 0 {
+		redirectType = a.redirectType()
+	}
+	http.Redirect(w, r, destination, redirectType)
 	return
 }
 
-// GetStats retrieves all stats for the service
+// GetStats retrieves the stats of the shorteners matching the query parameters,
+// in total and per tag
 func (a *App) GetStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := a.DB.CollectStats()
+	logger := LoggerFromContext(r.Context())
+	filter, err := linkFilterFromQuery(r)
 	if err != nil {
-		log.WithError(err).Error("Unable to collect stats from database")
+		writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	stats, err := a.DB.CollectStats(r.Context(), filter)
+	if err != nil {
+		logger.WithError(err).Error("Unable to collect stats from database")
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err = json.NewEncoder(w).Encode(&stats); err != nil {
-		log.WithField("response", stats).WithError(err).Error("Unable to serialize GetStats response")
+		logger.WithField("response", stats).WithError(err).Error("Unable to serialize GetStats response")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -198,46 +670,195 @@ func (a *App) GetStats(w http.ResponseWriter, r *http.Request) {
 
 // GetURLStats retrieves stats for the specified shortener
 func (a *App) GetURLStats(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
 	token := mux.Vars(r)["token"]
-	shortURL, err := a.DB.GetShortURL(token)
+	shortURL, err := a.DB.GetShortURL(r.Context(), token)
 	if err != nil {
-		log.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database")
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database")
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	clicks, err := a.DB.GetClicks(r.Context(), token)
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve clicks from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	stats := URLStats{shortURL, clicks}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err = json.NewEncoder(w).Encode(&shortURL); err != nil {
-		log.WithField("response", shortURL).WithError(err).Error("Unable to seralize GetURLStats response")
+	if err = json.NewEncoder(w).Encode(&stats); err != nil {
+		logger.WithField("response", stats).WithError(err).Error("Unable to seralize GetURLStats response")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-// DeleteAll removes all shorteners from the service
-func (a *App) DeleteAll(w http.ResponseWriter, r *http.Request) {
-	tokens, err := a.DB.GetAllURLTokens()
-	if err != nil {
-		log.WithError(err).Error("Unable to get all tokens from database in DeleteAll")
-		w.WriteHeader(http.StatusInternalServerError)
+// UpdateURL edits the specified shortener without changing its token
+func (a *App) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	token := mux.Vars(r)["token"]
+	var update db.LinkUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	for _, token := range tokens {
-		if err := a.DB.DeleteShortURL(token); err != nil {
-			log.WithError(err).WithField("token", token).Error("Unable to delete from database")
-			w.WriteHeader(http.StatusInternalServerError)
+	defer r.Body.Close()
+	if update.Rules != nil {
+		if err := update.Rules.Validate(); err != nil {
+			logger.WithError(err).Error("Invalid targeting rules in request body")
+			writeError(w, http.StatusBadRequest, "invalid_rules", err.Error())
 			return
 		}
 	}
-	w.WriteHeader(http.StatusNoContent)
-	return
+	if update.FallbackURL != nil && *update.FallbackURL != "" {
+		if _, err := url.ParseRequestURI(*update.FallbackURL); err != nil {
+			logger.WithField("fallback_url", *update.FallbackURL).WithError(err).Error("Unable to parse fallback URL from request body")
+			writeError(w, http.StatusBadRequest, "invalid_fallback_url", "fallback_url must be an absolute URL")
+			return
+		}
+	}
+	if update.Variants != nil {
+		if err := update.Variants.Validate(); err != nil {
+			logger.WithError(err).Error("Invalid variants in request body")
+			writeError(w, http.StatusBadRequest, "invalid_variants", err.Error())
+			return
+		}
+	}
+	if update.Folder != nil && !validFolder(*update.Folder) {
+		writeError(w, http.StatusBadRequest, "invalid_folder", "folder must be at most 100 characters without surrounding spaces")
+		return
+	}
+	if update.Tags != nil {
+		tags, err := normalizeTags(*update.Tags)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_tags", err.Error())
+			return
+		}
+		update.Tags = &tags
+	}
+	before, err := a.DB.GetShortURL(r.Context(), token)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database in UpdateURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	shortURL, err := a.DB.UpdateLink(r.Context(), token, &update, linkEvents(webhook.LinkUpdated, linkPayload))
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to update ShortURL in UpdateURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditUpdate, token, before, shortURL)
+	if err = a.refreshCache(r.Context(), shortURL, time.Now()); err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to refresh cached ShortURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(shortURL); err != nil {
+		logger.WithField("response", shortURL).WithError(err).Error("Unable to serialize UpdateURL response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 }
 
-// DeleteURL removes the specified shortener form the service
+// SetLinkStatus disables, suspends or re-enables the specified shortener. A link
+// that is not active is removed from the cache so redirects see the change at once.
+func (a *App) SetLinkStatus(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	token := mux.Vars(r)["token"]
+	var payload StatusPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if !db.ValidStatus(payload.Status) {
+		writeError(w, http.StatusBadRequest, "invalid_status", "status must be active, disabled or suspended")
+		return
+	}
+	before, err := a.DB.GetShortURL(r.Context(), token)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database in SetLinkStatus")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	shortURL, err := a.DB.SetStatus(r.Context(), token, &db.StatusChange{
+		Status: payload.Status,
+		Reason: payload.Reason,
+		Actor:  a.requestActor(r),
+		At:     now.UTC(),
+	}, linkEvents(webhook.LinkUpdated, linkPayload))
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to change ShortURL status in SetLinkStatus")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.WithFields(log.Fields{"token": token, "status": shortURL.Status, "actor": shortURL.StatusActor}).Info("Link status changed")
+	a.audit(r, AuditStatus, token, before, shortURL)
+	if err = a.refreshCache(r.Context(), shortURL, now); err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to refresh cached ShortURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(shortURL); err != nil {
+		logger.WithField("response", shortURL).WithError(err).Error("Unable to serialize SetLinkStatus response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteURL moves the specified shortener to the trash, its token stays reserved
+// until the trash is purged
 func (a *App) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
 	token := mux.Vars(r)["token"]
-	if err := a.DB.DeleteShortURL(token); err != nil {
-		log.WithField("token", token).WithError(err).Error("Unable to delete ShortURL in DeleteURL")
+	before, err := a.DB.GetShortURL(r.Context(), token)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database in DeleteURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = a.DB.DeleteShortURL(r.Context(), token, linkEvents(webhook.LinkDeleted, linkPayload))
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to delete ShortURL in DeleteURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditDelete, token, before, nil)
+	if err = a.Cache.DeleteURL(r.Context(), token); err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to delete ShortURL from cache in DeleteURL")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -245,42 +866,283 @@ func (a *App) DeleteURL(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (a *App) incrementRedirects(token string) {
-	shortURL, err := a.DB.GetShortURL(token)
-	if err != nil {
-		log.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database")
+func (a *App) metricsPath() string {
+	if a.MetricsPath == "" {
+		return defaultMetricsPath
+	}
+	return a.MetricsPath
+}
+
+func (a *App) isLeader() bool {
+	return a.Leader == nil || a.Leader.IsLeader()
+}
+
+func (a *App) scheduleJob(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		a.runJob(ctx, job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) runJob(ctx context.Context, job Job) {
+	if !a.isLeader() {
+		log.WithField("job", job.Name).Debug("Skipping job, not the leader")
 		return
 	}
-	shortURL.Redirects++
-	if err := a.DB.UpdateShortURL(shortURL); err != nil {
-		log.WithField("short_url", shortURL).WithError(err).Error("Unable to update ShortURL in database")
+	job.Run(ctx)
+}
+
+// flushPending waits for outstanding redirect counter writes, giving up when the context is done
+func (a *App) flushPending(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("Gave up waiting for pending redirect counters to flush")
+	}
+}
+
+func (a *App) close() {
+	if err := a.DB.Close(); err != nil {
+		log.WithError(err).Error("Unable to close database connection")
+	}
+	if err := a.Cache.Close(); err != nil {
+		log.WithError(err).Error("Unable to close cache connection")
 	}
 }
 
-func (a *App) cleanExpiredRecords() {
-	tokens, err := a.DB.GetAllURLTokens()
-	if err != nil {
-		log.WithError(err).Error("Unable to get all tokens in cleanExpiredRecords")
+func (a *App) incrementRedirects(ctx context.Context, token string) {
+	ctx, span := tracing.Tracer().Start(ctx, "incrementRedirects")
+	defer span.End()
+	logger := LoggerFromContext(ctx)
+	if _, err := a.DB.IncrementRedirects(ctx, token, a.milestoneEvents); err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to count redirect in database")
+	}
+}
+
+func (a *App) recordClick(ctx context.Context, token string, client targeting.Client, variant string) {
+	dimensions := map[string]string{
+		db.DimensionCountry: client.Country,
+		db.DimensionVariant: variant,
+	}
+	for dimension, value := range dimensions {
+		if value == "" {
+			continue
+		}
+		if err := a.DB.IncrementClicks(ctx, token, dimension, value); err != nil {
+			LoggerFromContext(ctx).WithFields(log.Fields{"token": token, "dimension": dimension}).WithError(err).Error("Unable to count click")
+		}
+	}
+}
+
+func (a *App) cleanExpiredRecords(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "cleanExpiredRecords")
+	defer span.End()
+	batchSize := a.SweepBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatchSize
 	}
 	now := time.Now()
 	count := 0
-	for _, token := range tokens {
-		shortURL, err := a.DB.GetShortURL(token)
+	for {
+		tokens, err := a.DB.DeleteExpired(ctx, now, batchSize, linkEvents(webhook.LinkExpired, tokenPayload))
 		if err != nil {
-			log.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database in cleanExpiredRecords")
-			continue
+			log.WithError(err).Error("Unable to delete expired ShortURLs from database in cleanExpiredRecords")
+			break
 		}
-		expireTime, err := time.Parse(time.RFC3339, shortURL.Expiration)
-		if err != nil {
-			log.WithField("time", expireTime).WithError(err).Error("Unable to parse expire time from database")
-			continue
+		for _, token := range tokens {
+			if err := a.Cache.DeleteURL(ctx, token); err != nil {
+				log.WithField("token", token).WithError(err).Error("Unable to purge expired URL from cache")
+			}
+		}
+		if len(tokens) > 0 {
+			a.recordAudit(ctx, &db.AuditEntry{
+				Action: AuditExpire,
+				Actor:  systemActor,
+				Before: snapshot(map[string]interface{}{"tokens": tokens, "before": now}),
+			})
 		}
-		if now.After(expireTime) {
-			a.DB.DeleteShortURL(token)
-			count++
+		count += len(tokens)
+		if len(tokens) < batchSize {
+			break
 		}
 	}
+	metrics.LinksExpired.Add(float64(count))
+	metrics.SweepExpired.Observe(float64(count))
 	if count > 0 {
 		log.WithField("deleted_urls", count).Info("Expired URLs removed from database")
 	}
+	if _, err := a.DB.PurgeTombstones(ctx, now.Add(-a.tombstoneTTL())); err != nil {
+		log.WithError(err).Error("Unable to purge tombstones of expired ShortURLs in cleanExpiredRecords")
+	}
+}
+
+// tombstoneTTL is how long a token the sweeper deleted keeps serving the
+// expired page before it is reported as not found
+func (a *App) tombstoneTTL() time.Duration {
+	if a.TombstoneTTL <= 0 {
+		return defaultTombstoneTTL
+	}
+	return a.TombstoneTTL
+}
+
+// newToken generates a token that no ShortURL uses, including those in the trash
+func (a *App) newToken(ctx context.Context) (string, error) {
+	for i := 0; i < maxTokenAttempts; i++ {
+		token, err := generateToken(tokenLength)
+		if err != nil {
+			return "", err
+		}
+		exists, err := a.DB.TokenExists(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return token, nil
+		}
+	}
+	return "", errors.New("unable to generate an unused token")
+}
+
+func (a *App) redirectType() int {
+	if a.RedirectType == 0 {
+		return defaultRedirectType
+	}
+	return a.RedirectType
+}
+
+// ValidRedirectType reports whether code is a redirect status a link may use
+func ValidRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// cachedLink builds the cache entry for a ShortURL
+func cachedLink(shortURL *db.ShortURL) *cache.Shortener {
+	return &cache.Shortener{
+		Token:           shortURL.Token,
+		URL:             shortURL.URL,
+		RedirectType:    shortURL.RedirectType,
+		Passthrough:     shortURL.Passthrough,
+		QueryPrecedence: shortURL.QueryPrecedence,
+		UTM:             shortURL.UTM.Params(),
+		Rules:           shortURL.Rules,
+		Variants:        shortURL.Variants,
+		Interstitial:    shortURL.Interstitial,
+		Activation:      shortURL.Activation,
+	}
+}
+
+// lookupLink gets the link for a token from the cache, or from the store when it
+// is not cached, and caches it again. When the link cannot be followed it returns
+// the state to report instead; an expired link with a fallback URL is followed to it.
+func (a *App) lookupLink(ctx context.Context, token string, now time.Time) (*cache.Shortener, string, error) {
+	link, err := a.Cache.GetURL(ctx, token)
+	if cache.Unreadable(err) {
+		// Another replica may have written the entry in a newer format, load the
+		// link and rewrite the entry in ours
+		LoggerFromContext(ctx).WithField("token", token).WithError(err).Warn("Unable to read cached link, loading it from the database")
+		err = cache.ErrNotFound
+	}
+	if err == cache.ErrNotFound {
+		link, err = a.loadLink(ctx, token, now)
+		if err == db.ErrNotFound {
+			return nil, StateNotFound, nil
+		}
+		if err == errExpired {
+			return nil, StateExpired, nil
+		}
+		if err == errDisabled {
+			return nil, StateDisabled, nil
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if activation, err := time.Parse(time.RFC3339, link.Activation); err == nil && now.Before(activation) {
+		return nil, StateNotYetActive, nil
+	}
+	return link, "", nil
+}
+
+var (
+	errExpired  = errors.New("short url expired")
+	errDisabled = errors.New("short url disabled")
+)
+
+// findShortURL gets the ShortURL with the token, returning errExpired instead
+// of db.ErrNotFound while the sweeper's tombstone for the token is kept
+func (a *App) findShortURL(ctx context.Context, token string) (*db.ShortURL, error) {
+	shortURL, err := a.DB.GetShortURL(ctx, token)
+	if err != db.ErrNotFound {
+		return shortURL, err
+	}
+	expired, tombErr := a.DB.TokenExpired(ctx, token)
+	if tombErr != nil {
+		return nil, tombErr
+	}
+	if expired {
+		return nil, errExpired
+	}
+	return nil, err
+}
+
+func (a *App) loadLink(ctx context.Context, token string, now time.Time) (*cache.Shortener, error) {
+	shortURL, err := a.findShortURL(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !shortURL.Enabled() {
+		return nil, errDisabled
+	}
+	expiration, err := time.Parse(time.RFC3339, shortURL.Expiration)
+	if err != nil || expiration.After(now) {
+		if err = a.refreshCache(ctx, shortURL, now); err != nil {
+			LoggerFromContext(ctx).WithField("token", token).WithError(err).Error("Unable to cache ShortURL")
+		}
+		return cachedLink(shortURL), nil
+	}
+	if shortURL.FallbackURL == "" {
+		return nil, errExpired
+	}
+	link := &cache.Shortener{
+		Token:        token,
+		URL:          shortURL.FallbackURL,
+		RedirectType: shortURL.RedirectType,
+	}
+	if err = a.Cache.SetURL(ctx, link, fallbackCacheTTL); err != nil {
+		LoggerFromContext(ctx).WithField("token", token).WithError(err).Error("Unable to cache fallback URL")
+	}
+	return link, nil
+}
+
+// refreshCache rewrites the cache entry for a ShortURL for the rest of its
+// lifetime, or removes it once the ShortURL has expired or is not active
+func (a *App) refreshCache(ctx context.Context, shortURL *db.ShortURL, now time.Time) error {
+	if !shortURL.Enabled() {
+		return a.Cache.DeleteURL(ctx, shortURL.Token)
+	}
+	expiration, err := time.Parse(time.RFC3339, shortURL.Expiration)
+	if err != nil {
+		return err
+	}
+	ttl := expiration.Sub(now)
+	if ttl <= 0 {
+		return a.Cache.DeleteURL(ctx, shortURL.Token)
+	}
+	return a.Cache.SetURL(ctx, cachedLink(shortURL), ttl)
 }
@@ -1,15 +1,20 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/derek-elliott/url-shortener/cache"
 	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/leader"
 	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -18,7 +23,9 @@ func TestSuccessfulRegisterShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, queuesEvents(webhook.LinkCreated, "testurl")).Return(nil)
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -47,7 +54,9 @@ func TestBadPayloadRegiterShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -81,7 +90,9 @@ func TestBadRequestRegiterShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -106,7 +117,9 @@ func TestBadTTLRegisterShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -133,7 +146,9 @@ func TestBadURLRegisterShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -160,7 +175,9 @@ func TestDBErrorCreateShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(errors.New("test db error"))
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test db error"))
 
 	testCache := &mocks.Cache{}
 	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -187,10 +204,12 @@ func TestCacheErrorCreateShortener(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CreateShortURL", mock.Anything).Return(nil)
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	testCache := &mocks.Cache{}
-	testCache.On("SetURL", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(errors.New("test db error"))
+	testCache.On("SetURL", mock.Anything, mock.AnythingOfType("*cache.Shortener"), mock.Anything).Return(errors.New("test db error"))
 
 	app := &App{
 		DB:       testDB,
@@ -214,10 +233,10 @@ func TestSuccessfulRedirectToURL(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", mock.AnythingOfType("string")).Return(&db.ShortURL{URL: "https://www.example.com", Token: "testurl", ShortenedURL: "test.com/testurl", Expiration: "", Redirects: 0}, nil)
-	testDB.On("UpdateShortURL", mock.Anything).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{URL: "https://www.example.com", Token: "testurl", ShortenedURL: "test.com/testurl", Expiration: "", Redirects: 0}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
 	testCache := &mocks.Cache{}
-	testCache.On("GetURL", mock.AnythingOfType("string")).Return(&cache.Shortener{Token: "testurl", URL: "https://www.example.com"}, nil)
+	testCache.On("GetURL", mock.Anything, mock.AnythingOfType("string")).Return(&cache.Shortener{Token: "testurl", URL: "https://www.example.com"}, nil)
 
 	app := &App{
 		DB:       testDB,
@@ -240,10 +259,10 @@ func TestBadCacheRedirectToURL(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
-	testDB.On("UpdateShortURL", mock.Anything).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
 	testCache := &mocks.Cache{}
-	testCache.On("GetURL", mock.AnythingOfType("string")).Return(&cache.Shortener{}, errors.New("test cache error"))
+	testCache.On("GetURL", mock.Anything, mock.AnythingOfType("string")).Return(&cache.Shortener{}, errors.New("test cache error"))
 
 	app := &App{
 		DB:       testDB,
@@ -262,11 +281,99 @@ func TestBadCacheRedirectToURL(t *testing.T) {
 
 }
 
+func TestRedirectTypeRegisterShortener(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		defaultType  int
+		status       int
+		redirectType int
+	}{
+		{"default", "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\"}", 0, http.StatusCreated, http.StatusFound},
+		{"configured default", "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\"}", http.StatusMovedPermanently, http.StatusCreated, http.StatusMovedPermanently},
+		{"requested", "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"redirect_type\": 307}", 0, http.StatusCreated, http.StatusTemporaryRedirect},
+		{"unsupported", "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"redirect_type\": 200}", 0, http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+			testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+			testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			testCache := &mocks.Cache{}
+			testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			app := &App{
+				DB:           testDB,
+				Cache:        testCache,
+				Hostname:     "test.com",
+				RedirectType: test.defaultType,
+			}
+
+			request, err := http.NewRequest("POST", "/", strings.NewReader(test.payload))
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.RegisterShortener(w, request)
+
+			assert.Equal(test.status, w.Code)
+			if test.redirectType != 0 {
+				testCache.AssertCalled(t, "SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool {
+					return s.RedirectType == test.redirectType
+				}), mock.Anything)
+			}
+		})
+	}
+}
+
+func TestRedirectTypeRedirectToURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		linkType     int
+		defaultType  int
+		redirectType int
+	}{
+		{"per link", http.StatusPermanentRedirect, 0, http.StatusPermanentRedirect},
+		{"legacy cache entry", 0, 0, http.StatusFound},
+		{"legacy cache entry with configured default", 0, http.StatusMovedPermanently, http.StatusMovedPermanently},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, mock.Anything).Return(&db.ShortURL{Token: "testurl"}, nil)
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testCache := &mocks.Cache{}
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{Token: "testurl", URL: "https://www.example.com", RedirectType: test.linkType}, nil)
+
+			app := &App{
+				DB:           testDB,
+				Cache:        testCache,
+				RedirectType: test.defaultType,
+			}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", "/testurl", nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(test.redirectType, w.Code)
+			assert.Equal("https://www.example.com", w.Header().Get("Location"))
+		})
+	}
+}
+
 func TestSuccessfulGetStats(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CollectStats").Return(&db.Stats{TotalURLs: 0, TotalRedirects: 0}, nil)
+	testDB.On("CollectStats", mock.Anything, mock.Anything).Return(&db.Stats{TotalURLs: 0, TotalRedirects: 0}, nil)
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -289,7 +396,7 @@ func TestBadDBGetStats(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("CollectStats").Return(&db.Stats{}, errors.New("test db error"))
+	testDB.On("CollectStats", mock.Anything, mock.Anything).Return(&db.Stats{}, errors.New("test db error"))
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -312,7 +419,8 @@ func TestSuccessfulGetURLStats(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
+	testDB.On("GetClicks", mock.Anything, mock.AnythingOfType("string")).Return(map[string]map[string]int{"country": {"US": 2}}, nil)
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -329,13 +437,14 @@ func TestSuccessfulGetURLStats(t *testing.T) {
 
 	testDB.AssertExpectations(t)
 	assert.Equal(http.StatusOK, w.Code, "successful GetURLStats")
+	assert.Contains(w.Body.String(), "\"clicks\":{\"country\":{\"US\":2}}")
 }
 
 func TestDBErrorGetURLStats(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", mock.AnythingOfType("string")).Return(&db.ShortURL{}, errors.New("test db error"))
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{}, errors.New("test db error"))
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -354,13 +463,17 @@ func TestDBErrorGetURLStats(t *testing.T) {
 	assert.Equal(http.StatusNotFound, w.Code, "db error in GetURLStats")
 }
 
-func TestSuccessfulDeleteAll(t *testing.T) {
+func TestSuccessfulDeleteURL(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{}, nil)
-	testDB.On("DeleteShortURL", mock.AnythingOfType("string")).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
+	testDB.On("DeleteShortURL", mock.Anything, mock.AnythingOfType("string"), queuesEvents(webhook.LinkDeleted, "testurl")).Return(nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditDelete && e.Before != nil && e.After == nil
+	})).Return(nil)
 	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, mock.AnythingOfType("string")).Return(nil)
 
 	app := &App{
 		DB:       testDB,
@@ -368,21 +481,21 @@ func TestSuccessfulDeleteAll(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	request, err := http.NewRequest("DELETE", "/", nil)
+	request, err := http.NewRequest("DELETE", "/testurl", nil)
 	assert.NoError(err)
 
 	w := httptest.NewRecorder()
-	app.DeleteAll(w, request)
+	app.DeleteURL(w, request)
 
-	assert.Equal(http.StatusNoContent, w.Code, "successful DeleteAll")
+	assert.Equal(http.StatusNoContent, w.Code, "successful DeleteURL")
 }
 
-func TestDBGetTokenErrorDeleteAll(t *testing.T) {
+func TestDBErrorDeleteURL(t *testing.T) {
 	assert := assert.New(t)
 
 	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{}, errors.New("test GetAllURLTokens error"))
-	testDB.On("DeleteShortURL", mock.AnythingOfType("string")).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, mock.AnythingOfType("string")).Return(&db.ShortURL{}, nil)
+	testDB.On("DeleteShortURL", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(errors.New("test DB error"))
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -391,21 +504,18 @@ func TestDBGetTokenErrorDeleteAll(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	request, err := http.NewRequest("DELETE", "/", nil)
+	request, err := http.NewRequest("DELETE", "/testurl", nil)
 	assert.NoError(err)
 
 	w := httptest.NewRecorder()
-	app.DeleteAll(w, request)
+	app.DeleteURL(w, request)
 
-	assert.Equal(http.StatusInternalServerError, w.Code, "GetAllURLTOkens error in DeleteAll")
+	assert.Equal(http.StatusInternalServerError, w.Code, "db error in DeleteURL")
 }
 
-func TestDBDeleteErrorDeleteAll(t *testing.T) {
-	assert := assert.New(t)
-
+func TestIncrementRedirects(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{"testurl"}, nil)
-	testDB.On("DeleteShortURL", mock.AnythingOfType("string")).Return(errors.New("test DeleteShortURL error"))
+	testDB.On("IncrementRedirects", mock.Anything, "testurl", mock.Anything).Return(1, nil)
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -414,43 +524,42 @@ func TestDBDeleteErrorDeleteAll(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	request, err := http.NewRequest("DELETE", "/", nil)
-	assert.NoError(err)
-
-	w := httptest.NewRecorder()
-	app.DeleteAll(w, request)
+	app.incrementRedirects(context.Background(), "testurl")
 
-	assert.Equal(http.StatusInternalServerError, w.Code, "GetAllURLTOkens error in DeleteAll")
+	testDB.AssertExpectations(t)
+	testDB.AssertNotCalled(t, "UpdateShortURL", mock.Anything, mock.Anything)
 }
 
-func TestSuccessfulDeleteURL(t *testing.T) {
-	assert := assert.New(t)
-
+func TestDBErrorIncrementRedirects(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("DeleteShortURL", mock.AnythingOfType("string")).Return(nil)
+	testDB.On("IncrementRedirects", mock.Anything, "testurl", mock.Anything).Return(0, errors.New("test db error"))
 	testCache := &mocks.Cache{}
 
 	app := &App{
-		DB:       testDB,
-		Cache:    testCache,
-		Hostname: "test.com",
+		DB:              testDB,
+		Cache:           testCache,
+		Hostname:        "test.com",
+		ClickMilestones: []int{0},
 	}
 
-	request, err := http.NewRequest("DELETE", "/testurl", nil)
-	assert.NoError(err)
+	app.incrementRedirects(context.Background(), "testurl")
 
-	w := httptest.NewRecorder()
-	app.DeleteURL(w, request)
-
-	assert.Equal(http.StatusNoContent, w.Code, "successful DeleteURL")
+	testDB.AssertCalled(t, "IncrementRedirects", mock.Anything, "testurl", mock.Anything)
 }
 
-func TestDBErrorDeleteURL(t *testing.T) {
-	assert := assert.New(t)
-
+func TestCleanExpiredRecords(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("DeleteShortURL", mock.AnythingOfType("string")).Return(errors.New("test DB error"))
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), defaultSweepBatchSize,
+		queuesEvents(webhook.LinkExpired, "testurl")).Return([]string{"testurl"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditExpire && e.Actor == systemActor && e.After == nil &&
+			strings.Contains(string(e.Before), `"tokens":["testurl"]`)
+	})).Return(nil)
+	testDB.On("PurgeTombstones", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) >= defaultTombstoneTTL
+	})).Return(1, nil)
 	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, "testurl").Return(nil)
 
 	app := &App{
 		DB:       testDB,
@@ -458,56 +567,40 @@ func TestDBErrorDeleteURL(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	request, err := http.NewRequest("DELETE", "/testurl", nil)
-	assert.NoError(err)
+	app.cleanExpiredRecords(context.Background())
 
-	w := httptest.NewRecorder()
-	app.DeleteURL(w, request)
-
-	assert.Equal(http.StatusInternalServerError, w.Code, "db error in DeleteURL")
+	testDB.AssertExpectations(t)
+	testCache.AssertExpectations(t)
 }
 
-func TestIncrementRedirects(t *testing.T) {
+func TestBatchedCleanExpiredRecords(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", "testurl").Return(
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    0},
-		nil)
-	testDB.On("UpdateShortURL",
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    1}).Return(nil)
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), 2, mock.Anything).Return([]string{"testurl1", "testurl2"}, nil).Once()
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), 2, mock.Anything).Return([]string{"testurl3"}, nil).Once()
+	testDB.On("PurgeTombstones", mock.Anything, mock.AnythingOfType("time.Time")).Return(0, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
 	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, mock.AnythingOfType("string")).Return(nil)
 
 	app := &App{
-		DB:       testDB,
-		Cache:    testCache,
-		Hostname: "test.com",
+		DB:             testDB,
+		Cache:          testCache,
+		Hostname:       "test.com",
+		SweepBatchSize: 2,
 	}
 
-	app.incrementRedirects("testurl")
+	app.cleanExpiredRecords(context.Background())
 
 	testDB.AssertExpectations(t)
-	testDB.AssertCalled(t, "UpdateShortURL",
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    1})
+	testDB.AssertNumberOfCalls(t, "DeleteExpired", 2)
+	testDB.AssertNumberOfCalls(t, "RecordAudit", 2)
+	testCache.AssertNumberOfCalls(t, "DeleteURL", 3)
 }
 
-func TestDBErrorIncrementRedirects(t *testing.T) {
+func TestNoURLSCleanExpiredRecords(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", "testurl").Return(&db.ShortURL{}, errors.New("test db error"))
-	testDB.On("UpdateShortURL", &db.ShortURL{}).Return(nil)
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), defaultSweepBatchSize, mock.Anything).Return([]string{}, nil)
+	testDB.On("PurgeTombstones", mock.Anything, mock.AnythingOfType("time.Time")).Return(0, nil)
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -516,29 +609,16 @@ func TestDBErrorIncrementRedirects(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	app.incrementRedirects("testurl")
+	app.cleanExpiredRecords(context.Background())
 
-	testDB.AssertCalled(t, "GetShortURL", "testurl")
-	testDB.AssertNotCalled(t, "UpdateShortURL")
+	testDB.AssertNumberOfCalls(t, "DeleteExpired", 1)
+	testCache.AssertNotCalled(t, "DeleteURL", mock.Anything, mock.Anything)
 }
 
-func TestDBErrorUpdateIncrementRedirects(t *testing.T) {
+func TestDBErrorCleanExpiredRecords(t *testing.T) {
 	testDB := &mocks.Store{}
-	testDB.On("GetShortURL", "testurl").Return(
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    0},
-		nil)
-	testDB.On("UpdateShortURL",
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    1}).Return(errors.New("test db error"))
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), defaultSweepBatchSize, mock.Anything).Return(nil, errors.New("test db error"))
+	testDB.On("PurgeTombstones", mock.Anything, mock.AnythingOfType("time.Time")).Return(0, nil)
 	testCache := &mocks.Cache{}
 
 	app := &App{
@@ -547,75 +627,108 @@ func TestDBErrorUpdateIncrementRedirects(t *testing.T) {
 		Hostname: "test.com",
 	}
 
-	app.incrementRedirects("testurl")
+	app.cleanExpiredRecords(context.Background())
 
-	testDB.AssertCalled(t, "GetShortURL", "testurl")
-	testDB.AssertCalled(t, "UpdateShortURL",
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "",
-			Redirects:    1})
+	testDB.AssertNumberOfCalls(t, "DeleteExpired", 1)
+	testCache.AssertNotCalled(t, "DeleteURL", mock.Anything, mock.Anything)
 }
 
-func TestCleanExpiredRecords(t *testing.T) {
-	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{"testurl"}, nil)
-	testDB.On("GetShortURL", "testurl").Return(
-		&db.ShortURL{
-			URL:          "https://www.example.com",
-			Token:        "testurl",
-			ShortenedURL: "test.com/testurl",
-			Expiration:   "2018-07-03T11:10:33-04:00",
-			Redirects:    0}, nil)
-	testDB.On("DeleteShortURL", "testurl").Return(nil)
-	testCache := &mocks.Cache{}
+func TestLeaderRunJob(t *testing.T) {
+	lock := leader.NewLocalLock(time.Minute)
+	app := &App{Leader: &leader.Monitor{Elector: lock.Elector("self")}}
+	app.Leader.Campaign()
 
-	app := &App{
-		DB:       testDB,
-		Cache:    testCache,
-		Hostname: "test.com",
-	}
+	ran := false
+	app.runJob(context.Background(), Job{Name: "Test", Run: func(ctx context.Context) { ran = true }})
 
-	app.cleanExpiredRecords()
+	assert.True(t, ran, "leader runs jobs")
+}
 
-	testDB.AssertExpectations(t)
+func TestFollowerSkipsJob(t *testing.T) {
+	lock := leader.NewLocalLock(time.Minute)
+	lock.Elector("other").Campaign()
+	app := &App{Leader: &leader.Monitor{Elector: lock.Elector("self")}}
+	app.Leader.Campaign()
+
+	ran := false
+	app.runJob(context.Background(), Job{Name: "Test", Run: func(ctx context.Context) { ran = true }})
+
+	assert.False(t, ran, "followers skip jobs")
 }
 
-func TestNoURLSCleanExpiredRecords(t *testing.T) {
+func TestGracefulShutdownRun(t *testing.T) {
+	assert := assert.New(t)
+
 	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{"testurl"}, errors.New("test db error"))
-	testDB.On("GetShortURL", "testurl").Return(&db.ShortURL{}, nil)
-	testDB.On("DeleteShortURL", "testurl").Return(nil)
+	testDB.On("DeleteExpired", mock.Anything, mock.AnythingOfType("time.Time"), defaultSweepBatchSize, mock.Anything).Return([]string{}, nil)
+	testDB.On("PurgeTombstones", mock.Anything, mock.AnythingOfType("time.Time")).Return(0, nil)
+	testDB.On("PurgeDeleted", mock.Anything, mock.AnythingOfType("time.Time"), defaultSweepBatchSize).Return([]string{}, nil)
+	testDB.On("ClaimDeliveries", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), webhookBatchSize).Return([]db.WebhookDelivery{}, nil)
+	testDB.On("ListInterstitialDomains", mock.Anything).Return([]db.InterstitialDomain{}, nil)
+	testDB.On("Close").Return(nil)
 	testCache := &mocks.Cache{}
+	testCache.On("Close").Return(nil)
 
+	lock := leader.NewLocalLock(time.Minute)
 	app := &App{
-		DB:       testDB,
-		Cache:    testCache,
-		Hostname: "test.com",
+		DB:         testDB,
+		Cache:      testCache,
+		Hostname:   "test.com",
+		Leader:     &leader.Monitor{Elector: lock.Elector("self"), Interval: time.Second},
+		DrainDelay: 100 * time.Millisecond,
 	}
 
-	app.cleanExpiredRecords()
-
-	testDB.AssertCalled(t, "GetAllURLTokens")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- app.Run(ctx, 0)
+	}()
+	start := time.Now()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(err)
+		assert.True(time.Since(start) >= app.DrainDelay, "waits for the drain delay before closing the listener")
+		assert.Equal(int32(1), atomic.LoadInt32(&app.draining), "reports not ready while draining")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	testDB.AssertCalled(t, "Close")
+	testCache.AssertCalled(t, "Close")
+	assert.False(app.Leader.IsLeader(), "leadership is given up on shutdown")
 }
 
-func TestDBErrorCleanExpiredRecords(t *testing.T) {
+func TestShutdownTimeoutEndsDrainRun(t *testing.T) {
+	assert := assert.New(t)
+
 	testDB := &mocks.Store{}
-	testDB.On("GetAllURLTokens").Return([]string{"testurl"}, nil)
-	testDB.On("GetShortURL", "testurl").Return(&db.ShortURL{}, errors.New("test db error"))
-	testDB.On("DeleteShortURL", "testurl").Return(nil)
+	testDB.On("ListInterstitialDomains", mock.Anything).Return([]db.InterstitialDomain{}, nil)
+	testDB.On("Close").Return(nil)
 	testCache := &mocks.Cache{}
+	testCache.On("Close").Return(nil)
 
+	lock := leader.NewLocalLock(time.Minute)
+	lock.Elector("other").Campaign()
 	app := &App{
-		DB:       testDB,
-		Cache:    testCache,
-		Hostname: "test.com",
+		DB:              testDB,
+		Cache:           testCache,
+		Leader:          &leader.Monitor{Elector: lock.Elector("self"), Interval: time.Second},
+		DrainDelay:      time.Minute,
+		ShutdownTimeout: 100 * time.Millisecond,
 	}
 
-	app.cleanExpiredRecords()
-
-	testDB.AssertCalled(t, "GetAllURLTokens")
-	testDB.AssertCalled(t, "GetShortURL", "testurl")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- app.Run(ctx, 0)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the drain delay outlasted the shutdown timeout")
+	}
 }
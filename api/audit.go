@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// Audited actions
+const (
+	AuditCreate          = "create"
+	AuditUpdate          = "update"
+	AuditDelete          = "delete"
+	AuditStatus          = "status"
+	AuditRestore         = "restore"
+	AuditBulkDelete      = "bulk_delete"
+	AuditPurge           = "purge"
+	AuditExpire          = "expire"
+	AuditTagRename       = "tag_rename"
+	AuditTagDelete       = "tag_delete"
+	AuditWebhookCreate   = "webhook_create"
+	AuditWebhookDelete   = "webhook_delete"
+	AuditInterstitialOn  = "interstitial_on"
+	AuditInterstitialOff = "interstitial_off"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	systemActor       = "system"
+)
+
+// ListAudit lists audit entries, newest first, filtered by the action, token,
+// actor, since and until query parameters
+func (a *App) ListAudit(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	query := r.URL.Query()
+	filter := db.AuditFilter{
+		Action: query.Get("action"),
+		Token:  query.Get("token"),
+		Actor:  query.Get("actor"),
+		Limit:  defaultAuditLimit,
+	}
+	for name, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_filter", name+" must be an RFC 3339 time")
+				return
+			}
+			*dest = &t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, "invalid_filter", "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	entries, err := a.DB.ListAudit(r.Context(), &filter)
+	if err != nil {
+		logger.WithError(err).Error("Unable to list audit entries from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(entries); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListAudit response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// audit records an action taken by the request on the token, with the state
+// before and after it
+func (a *App) audit(r *http.Request, action, token string, before, after interface{}) {
+	a.recordAudit(r.Context(), &db.AuditEntry{
+		Action:    action,
+		Token:     token,
+		Actor:     a.requestActor(r),
+		IP:        clientIP(r),
+		RequestID: RequestIDFromContext(r.Context()),
+		Before:    snapshot(before),
+		After:     snapshot(after),
+	})
+}
+
+// recordAudit appends the entry to the audit log and the audit sink. The action
+// has already happened, so failures are logged rather than returned.
+func (a *App) recordAudit(ctx context.Context, entry *db.AuditEntry) {
+	logger := LoggerFromContext(ctx).WithFields(log.Fields{"action": entry.Action, "token": entry.Token, "actor": entry.Actor})
+	entry.CreatedAt = time.Now().UTC()
+	if err := a.DB.RecordAudit(ctx, entry); err != nil {
+		logger.WithError(err).Error("Unable to record audit entry")
+	}
+	if a.AuditSink != nil {
+		if err := a.AuditSink.Write(entry); err != nil {
+			logger.WithError(err).Error("Unable to write audit entry to sink")
+		}
+	}
+}
+
+func snapshot(v interface{}) db.Snapshot {
+	if v == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Error("Unable to encode audit snapshot")
+		return nil
+	}
+	if string(encoded) == "null" {
+		return nil
+	}
+	return encoded
+}
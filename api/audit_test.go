@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type memorySink struct {
+	entries []*db.AuditEntry
+}
+
+func (s *memorySink) Write(entry *db.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestListAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	testDB := &mocks.Store{}
+	testDB.On("ListAudit", mock.Anything, mock.MatchedBy(func(f *db.AuditFilter) bool {
+		return f.Action == AuditDelete && f.Actor == "marketing" && f.Since != nil && f.Since.Equal(since) && f.Until == nil && f.Limit == 10
+	})).Return([]db.AuditEntry{{Action: AuditDelete, Token: "testurl", Actor: "marketing", Before: db.Snapshot(`{"token":"testurl"}`)}}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/audit?action=delete&actor=marketing&since=2026-01-01T00:00:00Z&limit=10", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"before":{"token":"testurl"}`)
+	assert.NotContains(w.Body.String(), `"after"`)
+}
+
+func TestInvalidFilterListAudit(t *testing.T) {
+	for _, query := range []string{"since=yesterday", "until=2026-01-01", "limit=0", "limit=5000"} {
+		assert := assert.New(t)
+
+		app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+		app.InitRouter()
+
+		request, err := http.NewRequest("GET", "/api/v1/audit?"+query, nil)
+		assert.NoError(err)
+
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, request)
+
+		assert.Equal(http.StatusBadRequest, w.Code, query)
+		assert.Contains(w.Body.String(), "invalid_filter", query)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditUpdate && e.Token == "testurl" && e.Actor == "ip:192.0.2.1" && e.IP == "192.0.2.1" &&
+			e.RequestID == "test-request" && !e.CreatedAt.IsZero()
+	})).Return(nil)
+	sink := &memorySink{}
+	app := &App{DB: testDB, Cache: &mocks.Cache{}, AuditSink: sink}
+
+	request, err := http.NewRequest("PATCH", "/testurl", nil)
+	assert.NoError(err)
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Header.Set("X-Request-ID", "test-request")
+
+	RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.audit(r, AuditUpdate, "testurl", &db.ShortURL{Token: "testurl"}, (*db.ShortURL)(nil))
+	})).ServeHTTP(httptest.NewRecorder(), request)
+
+	testDB.AssertExpectations(t)
+	assert.Len(sink.entries, 1)
+	assert.True(strings.Contains(string(sink.entries[0].Before), `"token":"testurl"`))
+	assert.Nil(sink.entries[0].After)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bulkDeleteSample = 20
+	// bulkConfirmationTTL is how long the confirmation from a dry run works
+	bulkConfirmationTTL = 5 * time.Minute
+)
+
+// BulkDeletePayload represents a payload to delete every shortener matching a filter.
+// A dry run reports the matches and a confirmation, which a destructive run must
+// send back unchanged within five minutes.
+type BulkDeletePayload struct {
+	Filter  db.LinkFilter `json:"filter"`
+	DryRun  bool          `json:"dry_run"`
+	Confirm string        `json:"confirm"`
+}
+
+// BulkDeleteResult reports the shorteners a bulk delete matched or deleted
+type BulkDeleteResult struct {
+	DryRun       bool     `json:"dry_run"`
+	Count        int      `json:"count"`
+	Sample       []string `json:"sample,omitempty"`
+	Confirmation string   `json:"confirmation,omitempty"`
+	Deleted      []string `json:"deleted,omitempty"`
+}
+
+// BulkDelete moves every shortener matching the filter to the trash. Nothing is
+// deleted without the confirmation from a dry run of the same filter, or when the
+// shorteners matching the filter changed since that dry run.
+func (a *App) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	var payload BulkDeletePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		writeError(w, http.StatusBadRequest, "invalid_filter", "request body must be a JSON bulk delete filter")
+		return
+	}
+	defer r.Body.Close()
+	filter := &payload.Filter
+	filter.Tag = normalizeTag(filter.Tag)
+
+	var result BulkDeleteResult
+	now := time.Now()
+	if payload.DryRun {
+		match, err := a.DB.MatchLinks(r.Context(), filter, bulkDeleteSample)
+		if err != nil {
+			logger.WithField("filter", filter).WithError(err).Error("Unable to match ShortURLs in BulkDelete")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		result = BulkDeleteResult{
+			DryRun:       true,
+			Count:        match.Count,
+			Sample:       match.Sample,
+			Confirmation: a.confirmation(filter, match.Digest, now),
+		}
+	} else {
+		if payload.Confirm == "" {
+			writeError(w, http.StatusPreconditionRequired, "confirmation_required", "run with dry_run first and send its confirmation")
+			return
+		}
+		digest, ok := a.checkConfirmation(filter, payload.Confirm, now)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_confirmation", "confirmation has expired or does not belong to this filter")
+			return
+		}
+		tokens, err := a.DB.DeleteLinks(r.Context(), filter, digest, linkEvents(webhook.LinkDeleted, tokenPayload))
+		if err == db.ErrMatchChanged {
+			writeError(w, http.StatusConflict, "match_changed", "the links matching the filter changed, run dry_run again")
+			return
+		}
+		if err != nil {
+			logger.WithField("filter", filter).WithError(err).Error("Unable to delete ShortURLs in BulkDelete")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, token := range tokens {
+			if err := a.Cache.DeleteURL(r.Context(), token); err != nil {
+				logger.WithField("token", token).WithError(err).Error("Unable to delete ShortURL from cache in BulkDelete")
+			}
+		}
+		logger.WithFields(log.Fields{"filter": filter, "deleted_urls": len(tokens)}).Info("ShortURLs bulk deleted")
+		result = BulkDeleteResult{Count: len(tokens), Deleted: tokens}
+		a.audit(r, AuditBulkDelete, "", nil, map[string]interface{}{"filter": filter, "deleted": tokens})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.WithField("response", result).WithError(err).Error("Unable to serialize BulkDelete response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// confirmation binds a filter to the exact set of shorteners it matched, by the
+// digest of their tokens, until it expires. It is signed with the server key, so
+// it can only come from a dry run.
+func (a *App) confirmation(filter *db.LinkFilter, digest string, now time.Time) string {
+	return digest + "." + a.sign(purposeBulkDelete, now.Add(bulkConfirmationTTL), filterKey(filter), digest)
+}
+
+// checkConfirmation returns the digest of the shorteners a confirmation was
+// issued for, and whether it was issued for the filter and has not expired
+func (a *App) checkConfirmation(filter *db.LinkFilter, confirm string, now time.Time) (string, bool) {
+	parts := strings.SplitN(confirm, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", false
+	}
+	if !a.verifySignature(parts[1], purposeBulkDelete, now, filterKey(filter), parts[0]) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func filterKey(filter *db.LinkFilter) string {
+	encoded, _ := json.Marshal(filter)
+	return string(encoded)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const bulkFilter = `"filter": {"owner": "marketing", "domain": "example.com", "expires_before": "2026-01-01T00:00:00Z"}`
+
+func bulkDelete(app *App, body string) *httptest.ResponseRecorder {
+	app.InitRouter()
+	request, _ := http.NewRequest("DELETE", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	return w
+}
+
+func TestDryRunBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("MatchLinks", mock.Anything, mock.MatchedBy(func(f *db.LinkFilter) bool {
+		return f.Owner == "marketing" && f.Domain == "example.com" && f.ExpiresBefore != nil && f.CreatedAfter == nil
+	}), bulkDeleteSample).Return(&db.LinkMatch{Count: 2, Sample: []string{"testurl1", "testurl2"}, Digest: "abc123"}, nil)
+
+	w := bulkDelete(&App{DB: testDB, Cache: &mocks.Cache{}}, `{`+bulkFilter+`, "dry_run": true}`)
+
+	assert.Equal(http.StatusOK, w.Code)
+	var result BulkDeleteResult
+	assert.NoError(json.NewDecoder(w.Body).Decode(&result))
+	assert.True(result.DryRun)
+	assert.Equal(2, result.Count)
+	assert.Equal([]string{"testurl1", "testurl2"}, result.Sample)
+	assert.True(strings.HasPrefix(result.Confirmation, "abc123."))
+	testDB.AssertNotCalled(t, "DeleteLinks", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConfirmedBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("MatchLinks", mock.Anything, mock.Anything, bulkDeleteSample).Return(&db.LinkMatch{Count: 2, Sample: []string{"testurl1", "testurl2"}, Digest: "abc123"}, nil)
+	testDB.On("DeleteLinks", mock.Anything, mock.Anything, "abc123",
+		queuesEvents(webhook.LinkDeleted, "testurl1", "testurl2")).Return([]string{"testurl1", "testurl2"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditBulkDelete && strings.Contains(string(e.After), "marketing")
+	})).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, "testurl1").Return(nil)
+	testCache.On("DeleteURL", mock.Anything, "testurl2").Return(nil)
+	app := &App{DB: testDB, Cache: testCache}
+
+	var dryRun BulkDeleteResult
+	assert.NoError(json.NewDecoder(bulkDelete(app, `{`+bulkFilter+`, "dry_run": true}`).Body).Decode(&dryRun))
+
+	w := bulkDelete(app, `{`+bulkFilter+`, "confirm": "`+dryRun.Confirmation+`"}`)
+
+	testDB.AssertExpectations(t)
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	var result BulkDeleteResult
+	assert.NoError(json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal([]string{"testurl1", "testurl2"}, result.Deleted)
+}
+
+func TestUnconfirmedBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	w := bulkDelete(&App{DB: testDB, Cache: &mocks.Cache{}}, `{`+bulkFilter+`}`)
+
+	assert.Equal(http.StatusPreconditionRequired, w.Code)
+	assert.Contains(w.Body.String(), "confirmation_required")
+	testDB.AssertNotCalled(t, "DeleteLinks", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOtherFilterBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	confirm := app.confirmation(&db.LinkFilter{Owner: "sales"}, "abc123", time.Now())
+	w := bulkDelete(app, `{`+bulkFilter+`, "confirm": "`+confirm+`"}`)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_confirmation")
+	testDB.AssertNotCalled(t, "DeleteLinks", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMatchChangedBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("DeleteLinks", mock.Anything, mock.Anything, "abc123", mock.Anything).Return(nil, db.ErrMatchChanged)
+	testCache := &mocks.Cache{}
+	app := &App{DB: testDB, Cache: testCache}
+	confirm := app.confirmation(&db.LinkFilter{Owner: "sales"}, "abc123", time.Now())
+
+	w := bulkDelete(app, `{"filter": {"owner": "sales"}, "confirm": "`+confirm+`"}`)
+
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Contains(w.Body.String(), "match_changed")
+	testCache.AssertNotCalled(t, "DeleteURL", mock.Anything, mock.Anything)
+}
+
+func TestInvalidFilterBulkDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	w := bulkDelete(&App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}, `{"filter": {"created_after": "yesterday"}, "dry_run": true}`)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_filter")
+}
+
+func TestCheckConfirmation(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{SigningKey: []byte("test key")}
+	filter := &db.LinkFilter{Owner: "marketing"}
+	now := time.Now()
+	confirm := app.confirmation(filter, "abc123", now)
+	digest, ok := app.checkConfirmation(filter, confirm, now)
+	assert.True(ok)
+	assert.Equal("abc123", digest)
+
+	signed := strings.SplitN(confirm, ".", 2)[1]
+	forged := func(digest string) string {
+		sum := sha256.Sum256([]byte(`{"owner":"marketing"}` + digest))
+		return digest + "." + hex.EncodeToString(sum[:16])
+	}
+	for _, confirm := range []string{"", "abc123", ".", "abc123.x", "def456." + signed, forged("abc123")} {
+		_, ok := app.checkConfirmation(filter, confirm, now)
+		assert.False(ok, confirm)
+	}
+	_, ok = app.checkConfirmation(filter, confirm, now.Add(bulkConfirmationTTL+time.Second))
+	assert.False(ok, "expired")
+	_, ok = (&App{SigningKey: []byte("other key")}).checkConfirmation(filter, confirm, now)
+	assert.False(ok, "signed with another key")
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HealthStatus reports whether the service is able to take traffic
+type HealthStatus struct {
+	Status   string                      `json:"status"`
+	Draining bool                        `json:"draining,omitempty"`
+	Checks   map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// DependencyStatus reports the health of a single dependency
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Healthz reports that the process is up
+func (a *App) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &HealthStatus{Status: "ok"})
+}
+
+// Readyz reports whether the database and cache are reachable and the service is not draining
+func (a *App) Readyz(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	status := HealthStatus{
+		Status: "ready",
+		Checks: map[string]DependencyStatus{
+			"db":    checkDependency(r.Context(), a.DB.Ping),
+			"cache": checkDependency(r.Context(), a.Cache.Ping),
+		},
+	}
+	code := http.StatusOK
+	for name, check := range status.Checks {
+		if check.Status != "up" {
+			logger.WithField("dependency", name).WithField("error", check.Error).Warn("Dependency not ready")
+			status.Status = "not_ready"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if atomic.LoadInt32(&a.draining) == 1 {
+		status.Status = "not_ready"
+		status.Draining = true
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, &status)
+}
+
+func checkDependency(ctx context.Context, ping func(context.Context) error) DependencyStatus {
+	start := time.Now()
+	err := ping(ctx)
+	status := DependencyStatus{
+		Status:    "up",
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func writeHealth(w http.ResponseWriter, code int, status *HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.WithField("response", status).WithError(err).Error("Unable to serialize health response")
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHealthz(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{}
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Healthz(w, request)
+
+	assert.Equal(http.StatusOK, w.Code, "process is up")
+}
+
+func TestReadyz(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("Ping", mock.Anything, mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("Ping", mock.Anything, mock.Anything).Return(nil)
+
+	app := &App{
+		DB:    testDB,
+		Cache: testCache,
+	}
+
+	request, err := http.NewRequest("GET", "/readyz", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Readyz(w, request)
+
+	var status HealthStatus
+	assert.NoError(json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(http.StatusOK, w.Code, "all dependencies up")
+	assert.Equal("ready", status.Status)
+	assert.Equal("up", status.Checks["db"].Status)
+	assert.Equal("up", status.Checks["cache"].Status)
+}
+
+func TestCacheDownReadyz(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("Ping", mock.Anything, mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("Ping", mock.Anything, mock.Anything).Return(errors.New("test cache error"))
+
+	app := &App{
+		DB:    testDB,
+		Cache: testCache,
+	}
+
+	request, err := http.NewRequest("GET", "/readyz", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Readyz(w, request)
+
+	var status HealthStatus
+	assert.NoError(json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(http.StatusServiceUnavailable, w.Code, "cache down")
+	assert.Equal("not_ready", status.Status)
+	assert.Equal("down", status.Checks["cache"].Status)
+	assert.Equal("test cache error", status.Checks["cache"].Error)
+}
+
+func TestDrainingReadyz(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("Ping", mock.Anything, mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("Ping", mock.Anything, mock.Anything).Return(nil)
+
+	app := &App{
+		DB:       testDB,
+		Cache:    testCache,
+		draining: 1,
+	}
+
+	request, err := http.NewRequest("GET", "/readyz", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Readyz(w, request)
+
+	var status HealthStatus
+	assert.NoError(json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(http.StatusServiceUnavailable, w.Code, "draining")
+	assert.True(status.Draining)
+}
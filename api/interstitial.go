@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// continueParam carries the signed confirmation of a redirect past the
+	// interstitial warning page
+	continueParam          = "snip_continue"
+	defaultContinueTTL     = 10 * time.Minute
+	defaultDomainsInterval = 30 * time.Second
+)
+
+// Interstitial reasons explain why a redirect shows the warning page
+const (
+	ReasonFlagged  = "flagged"
+	ReasonDomain   = "domain"
+	ReasonExternal = "external"
+	ReasonLink     = "link"
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// Interstitial configures which destinations get a warning page before the redirect
+type Interstitial struct {
+	// Watchlist holds domains, and their subdomains, that always get the warning
+	Watchlist []string
+	// AllowedDomains, when set, gives every destination outside them the warning
+	AllowedDomains []string
+	// ContinueTTL is how long the continue link on a warning page works
+	ContinueTTL time.Duration
+	// DomainsInterval is how often the domains admins turned the warning on for
+	// are reloaded from the store
+	DomainsInterval time.Duration
+}
+
+// interstitialDomains holds the domains admins turned the warning page on for,
+// so redirects do not query the store for them
+type interstitialDomains struct {
+	sync.RWMutex
+	domains []string
+}
+
+// WarningPage holds what the interstitial warning page shows
+type WarningPage struct {
+	Token       string
+	URL         string
+	Host        string
+	Reason      string
+	ContinueURL string
+}
+
+// reason returns why a redirect of link to destination needs the warning page, or
+// an empty string if it does not. domains are the domains admins turned it on for.
+func (i Interstitial) reason(link *cache.Shortener, destination string, domains []string) string {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return ReasonFlagged
+	}
+	host := target.Hostname()
+	if matchesDomain(host, i.Watchlist) {
+		return ReasonFlagged
+	}
+	if matchesDomain(host, domains) {
+		return ReasonDomain
+	}
+	if link.Interstitial {
+		return ReasonLink
+	}
+	if len(i.AllowedDomains) > 0 && !matchesDomain(host, i.AllowedDomains) {
+		return ReasonExternal
+	}
+	return ""
+}
+
+func matchesDomain(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i Interstitial) continueTTL() time.Duration {
+	if i.ContinueTTL <= 0 {
+		return defaultContinueTTL
+	}
+	return i.ContinueTTL
+}
+
+// continueURL is the request URL with a confirmation of the interstitial that
+// only works for the token and destination, and only until it expires. Anyone
+// sharing a flagged link cannot add one themselves to skip the warning.
+func (a *App) continueURL(requestURL *url.URL, token, destination string, now time.Time) string {
+	next := *requestURL
+	query := next.Query()
+	query.Set(continueParam, a.sign(purposeContinue, now.Add(a.Interstitial.continueTTL()), token, destination))
+	next.RawQuery = query.Encode()
+	return next.RequestURI()
+}
+
+// confirmedContinue reports whether confirmation was signed by continueURL for
+// the token and destination and has not expired
+func (a *App) confirmedContinue(confirmation, token, destination string, now time.Time) bool {
+	return confirmation != "" && a.verifySignature(confirmation, purposeContinue, now, token, destination)
+}
+
+// ListInterstitialDomains lists the domains admins turned the warning page on for
+func (a *App) ListInterstitialDomains(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	domains, err := a.DB.ListInterstitialDomains(r.Context())
+	if err != nil {
+		logger.WithError(err).Error("Unable to list interstitial domains from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(domains); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListInterstitialDomains response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// AddInterstitialDomain turns the warning page on for destinations on the
+// specified domain and its subdomains
+func (a *App) AddInterstitialDomain(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	domain := normalizeDomain(mux.Vars(r)["domain"])
+	if !domainPattern.MatchString(domain) {
+		writeError(w, http.StatusBadRequest, "invalid_domain", "domain must be a host name such as example.com")
+		return
+	}
+	if err := a.DB.AddInterstitialDomain(r.Context(), &db.InterstitialDomain{Domain: domain}); err != nil {
+		logger.WithField("domain", domain).WithError(err).Error("Unable to add interstitial domain to database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditInterstitialOn, "", nil, map[string]string{"domain": domain})
+	a.loadInterstitialDomains(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteInterstitialDomain turns the warning page off for the specified domain
+func (a *App) DeleteInterstitialDomain(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	domain := normalizeDomain(mux.Vars(r)["domain"])
+	err := a.DB.DeleteInterstitialDomain(r.Context(), domain)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("domain", domain).WithError(err).Error("Unable to delete interstitial domain from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditInterstitialOff, "", map[string]string{"domain": domain}, nil)
+	a.loadInterstitialDomains(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func normalizeDomain(domain string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// flaggedDomains returns the domains admins turned the warning page on for, as
+// last loaded from the store
+func (a *App) flaggedDomains() []string {
+	a.domains.RLock()
+	defer a.domains.RUnlock()
+	return a.domains.domains
+}
+
+// loadInterstitialDomains reloads the domains admins turned the warning page on
+// for, keeping the ones already loaded if the store fails
+func (a *App) loadInterstitialDomains(ctx context.Context) {
+	domains, err := a.DB.ListInterstitialDomains(ctx)
+	if err != nil {
+		LoggerFromContext(ctx).WithError(err).Error("Unable to load interstitial domains from database")
+		return
+	}
+	names := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		names = append(names, domain.Domain)
+	}
+	a.domains.Lock()
+	a.domains.domains = names
+	a.domains.Unlock()
+}
+
+// watchInterstitialDomains reloads the interstitial domains until the context is
+// done. Every replica runs it, not just the leader, since every replica redirects.
+func (a *App) watchInterstitialDomains(ctx context.Context) {
+	interval := a.Interstitial.DomainsInterval
+	if interval <= 0 {
+		interval = defaultDomainsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		a.loadInterstitialDomains(ctx)
+		select {
+		case <-ctx.Done():
+			log.Debug("Stopped reloading interstitial domains")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInterstitialReason(t *testing.T) {
+	interstitial := Interstitial{
+		Watchlist:      []string{"bad.example"},
+		AllowedDomains: []string{"example.com"},
+	}
+	tests := []struct {
+		name        string
+		link        cache.Shortener
+		destination string
+		reason      string
+	}{
+		{"allowed", cache.Shortener{}, "https://www.example.com/page", ""},
+		{"watchlist", cache.Shortener{}, "https://login.bad.example/", ReasonFlagged},
+		{"external", cache.Shortener{}, "https://www.example.org/", ReasonExternal},
+		{"per link", cache.Shortener{Interstitial: true}, "https://www.example.com/", ReasonLink},
+		{"lookalike", cache.Shortener{}, "https://notexample.com/", ReasonExternal},
+		{"per domain", cache.Shortener{Interstitial: true}, "https://shop.example.com/", ReasonDomain},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.reason, interstitial.reason(&test.link, test.destination, []string{"shop.example.com"}))
+		})
+	}
+	assert.Equal(t, "", Interstitial{}.reason(&cache.Shortener{}, "https://www.example.org/", nil), "no allowed domains")
+}
+
+func TestInterstitialRedirectToURL(t *testing.T) {
+	signer := &App{SigningKey: []byte("test key")}
+	now := time.Now()
+	valid := signer.sign(purposeContinue, now.Add(time.Minute), "testurl", "https://bad.example/path?ref=x")
+	expired := signer.sign(purposeContinue, now.Add(-time.Minute), "testurl", "https://bad.example/path?ref=x")
+	otherDestination := signer.sign(purposeContinue, now.Add(time.Minute), "testurl", "https://bad.example/other")
+	tests := []struct {
+		name     string
+		request  string
+		status   int
+		location string
+	}{
+		{"warning", "/testurl/path?ref=x", http.StatusOK, ""},
+		{"continue", "/testurl/path?ref=x&snip_continue=" + valid, http.StatusFound, "https://bad.example/path?ref=x"},
+		{"unsigned", "/testurl/path?ref=x&snip_continue=1", http.StatusOK, ""},
+		{"expired", "/testurl/path?ref=x&snip_continue=" + expired, http.StatusOK, ""},
+		{"other destination", "/testurl/path?ref=x&snip_continue=" + otherDestination, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testCache := &mocks.Cache{}
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{Token: "testurl", URL: "https://bad.example", Passthrough: true}, nil)
+
+			app := &App{
+				DB:           testDB,
+				Cache:        testCache,
+				Interstitial: Interstitial{Watchlist: []string{"bad.example"}},
+				SigningKey:   signer.SigningKey,
+			}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", test.request, nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(test.status, w.Code)
+			assert.Equal(test.location, w.Header().Get("Location"))
+			if test.status == http.StatusOK {
+				assert.Contains(w.Body.String(), "has been flagged")
+				assert.Contains(w.Body.String(), "href=\"/testurl/path?ref=x&amp;snip_continue=")
+				testDB.AssertNotCalled(t, "IncrementRedirects", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestContinueURL(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{SigningKey: []byte("test key")}
+	now := time.Now()
+	next, err := url.Parse(app.continueURL(&url.URL{Path: "/testurl", RawQuery: "snip_continue=1"}, "testurl", "https://bad.example", now))
+	assert.NoError(err)
+	confirmation := next.Query().Get(continueParam)
+
+	assert.True(app.confirmedContinue(confirmation, "testurl", "https://bad.example", now))
+	assert.False(app.confirmedContinue(confirmation, "other", "https://bad.example", now), "bound to the token")
+	assert.False(app.confirmedContinue(confirmation, "testurl", "https://bad.example", now.Add(defaultContinueTTL+time.Second)), "expires")
+	assert.False((&App{SigningKey: []byte("other key")}).confirmedContinue(confirmation, "testurl", "https://bad.example", now), "keyed")
+}
+
+func TestAddInterstitialDomain(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("AddInterstitialDomain", mock.Anything, &db.InterstitialDomain{Domain: "shop.example.com"}).Return(nil)
+	testDB.On("ListInterstitialDomains", mock.Anything).Return([]db.InterstitialDomain{{Domain: "shop.example.com"}}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditInterstitialOn
+	})).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/api/v1/interstitial/domains/Shop.Example.com.", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusNoContent, w.Code)
+	assert.Equal([]string{"shop.example.com"}, app.flaggedDomains())
+	assert.Equal(ReasonDomain, app.Interstitial.reason(&cache.Shortener{}, "https://www.shop.example.com/", app.flaggedDomains()))
+}
+
+func TestInvalidAddInterstitialDomain(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/api/v1/interstitial/domains/not_a%20domain", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_domain")
+}
+
+func TestNotFoundDeleteInterstitialDomain(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("DeleteInterstitialDomain", mock.Anything, "shop.example.com").Return(db.ErrNotFound)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("DELETE", "/api/v1/interstitial/domains/shop.example.com", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestLoadTemplates(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "warning.html"), []byte("custom warning for {{.Host}}"), 0644))
+
+	templates, err := LoadTemplates(dir)
+	assert.NoError(err)
+	assert.NotNil(templates.Lookup("preview.html"), "built-in templates are kept")
+
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{Token: "testurl", URL: "https://www.example.com", Interstitial: true}, nil)
+	app := &App{DB: &mocks.Store{}, Cache: testCache, Templates: templates}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("custom warning for www.example.com", w.Body.String())
+}
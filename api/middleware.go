@@ -1,23 +1,286 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/derek-elliott/url-shortener/metrics"
+	"github.com/derek-elliott/url-shortener/tracing"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Logger wraps a request and logs out the request information
-func Logger(next http.Handler) http.Handler {
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+	clientIPKey
+)
+
+// ClientIP resolves the client address once, honouring X-Forwarded-For only
+// from TrustedProxies, so every handler and middleware after it agrees on it
+func (a *App) ClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey, forwardedIP(r, a.TrustedProxies))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestID accepts the client's X-Request-ID or generates one, echoes it on the
+// response and puts it, along with a logger tagged with it, in the request context
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = withLogger(ctx, log.WithField("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID set by the RequestID middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// LoggerFromContext returns the request scoped logger, or the standard logger outside a request
+func LoggerFromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(loggerKey).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+func withLogger(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey, entry)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one line per request in JSON, logfmt or Apache Combined format
+type AccessLog struct {
+	// Format is one of "json", "logfmt" or "combined"
+	Format string
+	// RedirectSampleRate is the fraction of successful redirects that are logged, zero logs all of them
+	RedirectSampleRate float64
+	Out                io.Writer
+	logger             *log.Logger
+	once               sync.Once
+}
+
+// Middleware wraps a request and logs it once it has been served
+func (l *AccessLog) Middleware(next http.Handler) http.Handler {
+	l.once.Do(l.init)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(recorder, r)
+
+		route := routeName(r)
+		sampled := l.RedirectSampleRate > 0 && l.RedirectSampleRate < 1
+		if sampled && route == "Redirect" && recorder.status < http.StatusBadRequest && rand.Float64() >= l.RedirectSampleRate {
+			return
+		}
+		remoteIP := clientIP(r)
+		if l.Format == "combined" {
+			fmt.Fprintf(l.logger.Out, "%s - - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\"\n",
+				remoteIP, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.RequestURI, r.Proto,
+				recorder.status, recorder.bytes, r.Referer(), r.UserAgent())
+			return
+		}
+		l.logger.WithFields(log.Fields{
+			"request_id":  RequestIDFromContext(r.Context()),
+			"route":       route,
+			"method":      r.Method,
+			"request_uri": r.RequestURI,
+			"proto":       r.Proto,
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"remote_ip":   remoteIP,
+			"user_agent":  r.UserAgent(),
+			"referer":     r.Referer(),
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		}).Info("Request served")
+	})
+}
 
-		log.WithFields(log.Fields{
-			"method":        r.Method,
-			"request_uri":   r.RequestURI,
-			"response_time": time.Since(start),
-		}).Info("Request received")
+func (l *AccessLog) init() {
+	l.logger = log.New()
+	if l.Out != nil {
+		l.logger.Out = l.Out
+	}
+	if l.Format == "json" {
+		l.logger.Formatter = &log.JSONFormatter{}
+	} else {
+		l.logger.Formatter = &log.TextFormatter{DisableColors: true, FullTimestamp: true}
+	}
+}
+
+// Metrics wraps a request and records its count and latency under the matched route name
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := routeName(r)
+		metrics.RequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		metrics.RequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Tracing wraps a request in a server span, continuing any W3C trace context sent by the client
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			))
+		defer span.End()
+		ctx = withLogger(ctx, LoggerFromContext(ctx).WithField("trace_id", span.SpanContext().TraceID().String()))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
 	})
 }
+
+// routePolicies maps route names to the rate limit policy that applies to them
+var routePolicies = map[string]string{
+	"Register":                 "create",
+	"Redirect":                 "redirect",
+	"Preview":                  "redirect",
+	"Stats":                    "admin",
+	"URLStats":                 "admin",
+	"BulkDelete":               "admin",
+	"DeleteURL":                "admin",
+	"UpdateURL":                "admin",
+	"SetStatus":                "admin",
+	"Usage":                    "admin",
+	"ListLinks":                "admin",
+	"ListTags":                 "admin",
+	"RenameTag":                "admin",
+	"DeleteTag":                "admin",
+	"ListFolders":              "admin",
+	"ListInterstitialDomains":  "admin",
+	"AddInterstitialDomain":    "admin",
+	"DeleteInterstitialDomain": "admin",
+	"ListWebhooks":             "admin",
+	"CreateWebhook":            "admin",
+	"DeleteWebhook":            "admin",
+	"ListDeliveries":           "admin",
+	"Audit":                    "admin",
+	"ListTrash":                "admin",
+	"Restore":                  "admin",
+	"RestoreAll":               "admin",
+}
+
+// RateLimit throttles requests per API key of a known account, or per client IP
+// otherwise so made up keys do not get fresh buckets, using the policy for the
+// matched route
+func (a *App) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := routePolicies[routeName(r)]
+		policy, ok := a.RateLimits[name]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := name + ":ip:" + clientIP(r)
+		if apiKey := requestAPIKey(r); apiKey != "" {
+			if _, ok := a.Accounts[apiKey]; ok {
+				key = name + ":key:" + hashKey(apiKey)
+			}
+		}
+		res, err := a.RateLimiter.Allow(r.Context(), key, policy)
+		if err != nil {
+			LoggerFromContext(r.Context()).WithError(err).Error("Unable to check rate limit, allowing request")
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(res.Reset/time.Second)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter/time.Second)))
+			metrics.RateLimited.WithLabelValues(name).Inc()
+			a.writeStatus(w, r, StateRateLimited, mux.Vars(r)["token"])
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func routeName(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil && current.GetName() != "" {
+		return current.GetName()
+	}
+	return "unknown"
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
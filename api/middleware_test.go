@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	app.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	request, err = http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(err)
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code, "metrics served on the main router")
+	assert.Contains(w.Body.String(), `snip_http_requests_total{code="200",method="GET",route="Healthz"}`)
+	assert.Contains(w.Body.String(), "go_goroutines")
+}
+
+func TestMetricsOnSeparateAddress(t *testing.T) {
+	app := &App{MetricsAddress: ":0"}
+	app.InitRouter()
+
+	assert.Nil(t, app.Router.Get("Metrics"), "metrics not routed on the public router")
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	app := &App{}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	app.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	assert.Len(spans, 1)
+	assert.Equal("GET /healthz", spans[0].Name())
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String(), "trace context continued from the request")
+}
+
+func TestGeneratedRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	var id string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFromContext(r.Context())
+	}))
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+
+	assert.NotEqual("", id, "request ID generated")
+	assert.Equal(id, w.Header().Get("X-Request-ID"), "request ID echoed")
+}
+
+func TestAcceptedRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	var id string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFromContext(r.Context())
+	}))
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+	request.Header.Set("X-Request-ID", "client-id-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+
+	assert.Equal("client-id-1", id, "client request ID kept")
+	assert.Equal("client-id-1", w.Header().Get("X-Request-ID"))
+}
+
+func TestInvalidRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	var id string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFromContext(r.Context())
+	}))
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+	request.Header.Set("X-Request-ID", "bad id\n")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.NotEqual("bad id\n", id, "invalid request ID replaced")
+}
+
+func TestJSONAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	app := &App{AccessLog: &AccessLog{Format: "json", Out: &out}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	request.Header.Set("X-Request-ID", "access-log-test")
+	request.Header.Set("User-Agent", "test-agent")
+	request.RemoteAddr = "10.0.0.1:1234"
+	app.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	var line map[string]interface{}
+	assert.NoError(json.Unmarshal(out.Bytes(), &line))
+	assert.Equal("access-log-test", line["request_id"])
+	assert.Equal("Healthz", line["route"])
+	assert.Equal(float64(http.StatusOK), line["status"])
+	assert.Equal("10.0.0.1", line["remote_ip"])
+	assert.Equal("test-agent", line["user_agent"])
+	assert.NotZero(line["bytes"])
+}
+
+func TestTrustedProxyAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8"})
+	assert.NoError(err)
+	var out bytes.Buffer
+	app := &App{AccessLog: &AccessLog{Format: "json", Out: &out}, TrustedProxies: trusted}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	request.Header.Set("X-Forwarded-For", "198.51.100.1")
+	request.RemoteAddr = "10.0.0.1:1234"
+	app.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	var line map[string]interface{}
+	assert.NoError(json.Unmarshal(out.Bytes(), &line))
+	assert.Equal("198.51.100.1", line["remote_ip"], "client behind a trusted proxy")
+}
+
+func TestCombinedAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	app := &App{AccessLog: &AccessLog{Format: "combined", Out: &out}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	request.RequestURI = "/healthz"
+	request.Header.Set("User-Agent", "test-agent")
+	request.RemoteAddr = "10.0.0.1:1234"
+	app.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Regexp(`^10\.0\.0\.1 - - \[.+\] "GET /healthz HTTP/1\.1" 200 \d+ "" "test-agent"\n$`, out.String())
+}
+
+func TestSampledRedirectAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, mock.Anything).Return(&db.ShortURL{}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{Token: "testurl", URL: "https://www.example.com"}, nil)
+
+	var out bytes.Buffer
+	app := &App{
+		DB:        testDB,
+		Cache:     testCache,
+		AccessLog: &AccessLog{Format: "json", Out: &out, RedirectSampleRate: 0.000001},
+	}
+	app.InitRouter()
+
+	for i := 0; i < 10; i++ {
+		request, err := http.NewRequest("GET", "/testurl", nil)
+		assert.NoError(err)
+		app.Router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	app.pending.Wait()
+
+	assert.Equal("", out.String(), "redirects sampled out of the access log")
+}
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("Ping", mock.Anything).Return(nil)
+	testDB.On("CollectStats", mock.Anything, mock.Anything).Return(&db.Stats{}, nil)
+	testCache := &mocks.Cache{}
+
+	app := &App{
+		DB:          testDB,
+		Cache:       testCache,
+		RateLimiter: ratelimit.NewMemoryLimiter(),
+		RateLimits: map[string]ratelimit.Policy{
+			"admin": {Requests: 1, Per: time.Minute, Burst: 2},
+		},
+		Accounts: map[string]Account{"test-key": {Owner: "tester"}},
+	}
+	app.InitRouter()
+
+	for i := 0; i < 2; i++ {
+		request, err := http.NewRequest("GET", "/admin/stats", nil)
+		assert.NoError(err)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, request)
+		assert.Equal(http.StatusOK, w.Code, "within burst")
+		assert.Equal("2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(strconv.Itoa(1-i), w.Header().Get("RateLimit-Remaining"))
+	}
+
+	request, err := http.NewRequest("GET", "/admin/stats", nil)
+	assert.NoError(err)
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	assert.Equal(http.StatusTooManyRequests, w.Code, "burst exhausted")
+	assert.Equal("60", w.Header().Get("Retry-After"))
+
+	request, err = http.NewRequest("GET", "/admin/stats", nil)
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "test-key")
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	assert.Equal(http.StatusOK, w.Code, "API keys are limited separately from IPs")
+
+	request, err = http.NewRequest("GET", "/admin/stats", nil)
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "made-up-key")
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	assert.Equal(http.StatusTooManyRequests, w.Code, "unknown API keys share the IP's bucket")
+
+	request, err = http.NewRequest("GET", "/healthz", nil)
+	assert.NoError(err)
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	assert.Equal(http.StatusOK, w.Code, "routes without a policy are not limited")
+	assert.Equal("", w.Header().Get("RateLimit-Limit"))
+}
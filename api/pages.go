@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/gorilla/mux"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var defaultTemplates = template.Must(parseDefaultTemplates())
+
+func parseDefaultTemplates() (*template.Template, error) {
+	return template.ParseFS(templateFS, "templates/*.html")
+}
+
+// LoadTemplates returns the built-in page templates with any of them replaced by
+// the .html files of the same name in dir
+func LoadTemplates(dir string) (*template.Template, error) {
+	templates, err := parseDefaultTemplates()
+	if err != nil || dir == "" {
+		return templates, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(files) == 0 {
+		return templates, err
+	}
+	return templates.ParseFiles(files...)
+}
+
+func (a *App) templates() *template.Template {
+	if a.Templates == nil {
+		return defaultTemplates
+	}
+	return a.Templates
+}
+
+// hostOf returns the host of a URL, or the URL itself if it has none
+func hostOf(rawURL string) string {
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return rawURL
+}
+
+// PreviewPage holds what the preview page shows about a shortener
+type PreviewPage struct {
+	Token        string
+	ShortenedURL string
+	URL          string
+	Host         string
+	CreatedAt    time.Time
+	Expiration   time.Time
+	Redirects    int
+}
+
+func newPreviewPage(shortURL *db.ShortURL) PreviewPage {
+	page := PreviewPage{
+		Token:        shortURL.Token,
+		ShortenedURL: shortURL.ShortenedURL,
+		URL:          shortURL.URL,
+		CreatedAt:    shortURL.CreatedAt,
+		Redirects:    shortURL.Redirects,
+	}
+	page.Host = hostOf(shortURL.URL)
+	if expiration, err := time.Parse(time.RFC3339, shortURL.Expiration); err == nil {
+		page.Expiration = expiration
+	}
+	return page
+}
+
+// PreviewURL shows where a shortener goes without redirecting or counting a click.
+// A shortener that would not redirect shows the same status page as a redirect.
+func (a *App) PreviewURL(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	token := mux.Vars(r)["token"]
+	shortURL, err := a.findShortURL(r.Context(), token)
+	if err == db.ErrNotFound {
+		a.writeStatus(w, r, StateNotFound, token)
+		return
+	}
+	if err == errExpired {
+		a.writeStatus(w, r, StateExpired, token)
+		return
+	}
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve ShortURL from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if state := previewState(shortURL, time.Now()); state != "" {
+		a.writeStatus(w, r, state, token)
+		return
+	}
+	page := newPreviewPage(shortURL)
+	if !page.Expiration.IsZero() && !page.Expiration.After(time.Now()) {
+		page.URL = shortURL.FallbackURL
+		page.Host = hostOf(shortURL.FallbackURL)
+	}
+	a.renderPage(w, r, http.StatusOK, "preview.html", page)
+}
+
+// previewState returns the state a redirect of the shortener would report
+// instead of redirecting, or an empty string if it would redirect. An expired
+// shortener with a fallback URL still redirects, to the fallback.
+func previewState(shortURL *db.ShortURL, now time.Time) string {
+	if !shortURL.Enabled() {
+		return StateDisabled
+	}
+	if activation, err := time.Parse(time.RFC3339, shortURL.Activation); err == nil && now.Before(activation) {
+		return StateNotYetActive
+	}
+	if expiration, err := time.Parse(time.RFC3339, shortURL.Expiration); err == nil && !expiration.After(now) && shortURL.FallbackURL == "" {
+		return StateExpired
+	}
+	return ""
+}
+
+// renderPage writes the named HTML template, rendering into a buffer first so
+// a template error can still be reported as a 500
+func (a *App) renderPage(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	var page bytes.Buffer
+	if err := a.templates().ExecuteTemplate(&page, name, data); err != nil {
+		LoggerFromContext(r.Context()).WithField("template", name).WithError(err).Error("Unable to render page")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPreviewURL(t *testing.T) {
+	for _, path := range []string{"/testurl+", "/testurl?preview=1"} {
+		t.Run(path, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+				Token:        "testurl",
+				URL:          "https://www.example.com/page?a=1&b=2",
+				ShortenedURL: "test.com/testurl",
+				Expiration:   "2030-01-02T15:04:05Z",
+				Redirects:    42,
+				CreatedAt:    time.Date(2024, time.March, 1, 9, 30, 0, 0, time.UTC),
+			}, nil)
+			testCache := &mocks.Cache{}
+
+			app := &App{DB: testDB, Cache: testCache}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", path, nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			body := w.Body.String()
+			assert.Equal(http.StatusOK, w.Code)
+			assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Contains(body, "https://www.example.com/page?a=1&amp;b=2")
+			assert.Contains(body, "1 March 2024 09:30 UTC")
+			assert.Contains(body, "2 January 2030 15:04 UTC")
+			assert.Contains(body, "<dd>42</dd>")
+			assert.Contains(body, "href=\"/testurl\"")
+			testDB.AssertNotCalled(t, "IncrementRedirects", mock.Anything, mock.Anything, mock.Anything)
+			testCache.AssertNotCalled(t, "GetURL", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestStatePreviewURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		shortURL *db.ShortURL
+		err      error
+		swept    bool
+		status   int
+		code     string
+	}{
+		{"not found", &db.ShortURL{}, db.ErrNotFound, false, http.StatusNotFound, StateNotFound},
+		{"swept", &db.ShortURL{}, db.ErrNotFound, true, http.StatusGone, StateExpired},
+		{"db error", &db.ShortURL{}, errors.New("test db error"), false, http.StatusInternalServerError, ""},
+		{"disabled", &db.ShortURL{Token: "testurl", Status: db.StatusDisabled}, nil, false, http.StatusForbidden, StateDisabled},
+		{"not yet active", &db.ShortURL{Token: "testurl", URL: "https://secret.example.com", Activation: time.Now().Add(time.Hour).Format(time.RFC3339)}, nil, false, http.StatusForbidden, StateNotYetActive},
+		{"expired", &db.ShortURL{Token: "testurl", URL: "https://www.example.com", Expiration: time.Now().Add(-time.Hour).Format(time.RFC3339)}, nil, false, http.StatusGone, StateExpired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(test.shortURL, test.err)
+			testDB.On("TokenExpired", mock.Anything, "testurl").Return(test.swept, nil)
+
+			app := &App{DB: testDB, Cache: &mocks.Cache{}}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", "/testurl+", nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+
+			assert.Equal(test.status, w.Code)
+			assert.Contains(w.Body.String(), test.code)
+			assert.NotContains(w.Body.String(), "secret.example.com")
+		})
+	}
+}
+
+func TestFallbackPreviewURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+		Token:       "testurl",
+		URL:         "https://www.example.com",
+		FallbackURL: "https://fallback.example.com",
+		Expiration:  time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl+", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "https://fallback.example.com")
+}
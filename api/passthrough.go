@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/derek-elliott/url-shortener/cache"
+)
+
+// Query precedences decide which value wins when a passthrough request and the
+// destination URL set the same query parameter
+const (
+	PrecedenceLink    = "link"
+	PrecedenceRequest = "request"
+)
+
+// ValidQueryPrecedence reports whether precedence is a supported query precedence
+func ValidQueryPrecedence(precedence string) bool {
+	return precedence == PrecedenceLink || precedence == PrecedenceRequest
+}
+
+func (a *App) queryPrecedence(link *cache.Shortener) string {
+	if link.QueryPrecedence != "" {
+		return link.QueryPrecedence
+	}
+	if a.QueryPrecedence != "" {
+		return a.QueryPrecedence
+	}
+	return defaultQueryPrecedence
+}
+
+// passthroughURL appends the trailing path of a request to the destination and
+// merges the request query into the destination query
+func passthroughURL(destination, path string, query url.Values, precedence string) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	if path != "" {
+		target.Path = strings.TrimSuffix(target.Path, "/") + path
+		target.RawPath = ""
+	}
+	if len(query) == 0 {
+		return target.String(), nil
+	}
+	target.RawQuery = mergeQuery(target.RawQuery, query, precedence == PrecedenceRequest)
+	return target.String(), nil
+}
+
+// mergeQuery adds params to a raw query, replacing the values of the keys it
+// already has when replace is set. Parameters it does not change keep their
+// order and encoding, as destinations like signed URLs depend on both.
+func mergeQuery(rawQuery string, params url.Values, replace bool) string {
+	var parts []string
+	seen := map[string]bool{}
+	if rawQuery != "" {
+		for _, part := range strings.Split(rawQuery, "&") {
+			key := part
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				key = part[:i]
+			}
+			if unescaped, err := url.QueryUnescape(key); err == nil {
+				key = unescaped
+			}
+			values, ok := params[key]
+			if !ok || !replace {
+				parts = append(parts, part)
+			} else if !seen[key] {
+				parts = append(parts, encodeParam(key, values)...)
+			}
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, encodeParam(key, params[key])...)
+	}
+	return strings.Join(parts, "&")
+}
+
+func encodeParam(key string, values []string) []string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = url.QueryEscape(key) + "=" + url.QueryEscape(value)
+	}
+	return parts
+}
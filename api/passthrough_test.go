@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPassthroughURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		path        string
+		query       string
+		precedence  string
+		want        string
+	}{
+		{"path", "https://www.example.com/docs/", "/guide/intro", "", PrecedenceLink, "https://www.example.com/docs/guide/intro"},
+		{"query", "https://www.example.com/", "", "utm_source=x", PrecedenceLink, "https://www.example.com/?utm_source=x"},
+		{"link wins", "https://www.example.com/?ref=link&a=1", "", "ref=request&b=2", PrecedenceLink, "https://www.example.com/?ref=link&a=1&b=2"},
+		{"destination query kept as is", "https://cdn.example.com/f?sig=a%2Fb&expires=9&sig2=x+y", "", "a=1", PrecedenceLink, "https://cdn.example.com/f?sig=a%2Fb&expires=9&sig2=x+y&a=1"},
+		{"request replaces in place", "https://www.example.com/?z=1&ref=link&ref=again&a=1", "", "ref=request", PrecedenceRequest, "https://www.example.com/?z=1&ref=request&a=1"},
+		{"request wins", "https://www.example.com/?ref=link", "", "ref=request", PrecedenceRequest, "https://www.example.com/?ref=request"},
+		{"nothing to merge", "https://www.example.com/?a=1", "", "", PrecedenceLink, "https://www.example.com/?a=1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			assert.NoError(t, err)
+			got, err := passthroughURL(test.destination, test.path, query, test.precedence)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestPassthroughRedirectToURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     cache.Shortener
+		request  string
+		status   int
+		location string
+	}{
+		{"passthrough", cache.Shortener{URL: "https://www.example.com/docs", Passthrough: true}, "/testurl/intro?utm_source=x", http.StatusFound, "https://www.example.com/docs/intro?utm_source=x"},
+		{"query dropped without passthrough", cache.Shortener{URL: "https://www.example.com/docs"}, "/testurl?utm_source=x", http.StatusFound, "https://www.example.com/docs"},
+		{"path without passthrough", cache.Shortener{URL: "https://www.example.com/docs"}, "/testurl/intro", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testCache := &mocks.Cache{}
+			link := test.link
+			link.Token = "testurl"
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&link, nil)
+
+			app := &App{
+				DB:    testDB,
+				Cache: testCache,
+			}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", test.request, nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(test.status, w.Code)
+			assert.Equal(test.location, w.Header().Get("Location"))
+			if test.status == http.StatusNotFound {
+				var apiErr APIError
+				assert.NoError(json.NewDecoder(w.Body).Decode(&apiErr))
+				assert.Equal(StateNotFound, apiErr.Code)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesNotShadowedByPassthrough(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("CollectStats", mock.Anything, mock.Anything).Return(&db.Stats{}, nil)
+
+	app := &App{
+		DB:    testDB,
+		Cache: &mocks.Cache{},
+	}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/admin/stats", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	testDB.AssertExpectations(t)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+)
+
+// Account is the holder of an API key, it owns the links registered with that key
+type Account struct {
+	Owner string
+	Quota Quota
+}
+
+// Quota caps what an owner may register, a zero limit is unlimited. Anonymous
+// creations are counted per client IP, and as their links have no owner to
+// count them by anonymous callers are not capped on active links.
+type Quota struct {
+	MaxActiveLinks int
+	MaxCreations   int
+	// Period is the length of the creation window, calendar months (UTC) when zero
+	Period time.Duration
+	MaxTTL time.Duration
+}
+
+// QuotaUsage reports an owner's consumption against its quota
+type QuotaUsage struct {
+	Owner       string     `json:"owner"`
+	ActiveLinks UsageCount `json:"active_links"`
+	Creations   UsageCount `json:"creations"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	MaxTTL      string     `json:"max_ttl,omitempty"`
+}
+
+// UsageCount holds a used amount and its limit, the limit is omitted when unlimited
+type UsageCount struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit,omitempty"`
+}
+
+// quotaError describes why a registration was refused by a quota
+type quotaError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (q Quota) periodStart(now time.Time) time.Time {
+	now = now.UTC()
+	if q.Period <= 0 {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return now.Truncate(q.Period)
+}
+
+func (q Quota) periodEnd(start time.Time) time.Time {
+	if q.Period <= 0 {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.Add(q.Period)
+}
+
+// tracksCreations reports whether creations are counted for the account
+func (acc *Account) tracksCreations() bool {
+	return acc.Owner != "" || acc.Quota.MaxCreations > 0
+}
+
+// requestAccount resolves the account for the request's API key. Requests without a
+// key are anonymous and get the default quota, unknown keys are refused.
+func (a *App) requestAccount(r *http.Request) (*Account, bool) {
+	key := requestAPIKey(r)
+	if key == "" {
+		return &Account{Quota: a.DefaultQuota}, true
+	}
+	account, ok := a.Accounts[key]
+	if !ok {
+		return nil, false
+	}
+	return &account, true
+}
+
+// checkQuota verifies that the account may register a link with the given TTL.
+// The counted limits are enforced by the store as the link is created.
+func checkQuota(account *Account, ttl time.Duration) *quotaError {
+	if maxTTL := account.Quota.MaxTTL; maxTTL > 0 && ttl > maxTTL {
+		return &quotaError{http.StatusForbidden, "ttl_quota_exceeded", "TTL is longer than the " + maxTTL.String() + " allowed by the quota"}
+	}
+	return nil
+}
+
+// quotaClaim is what registering a link counts against the account's quota, or
+// nil when nothing is counted
+func (a *App) quotaClaim(r *http.Request, account *Account, now time.Time) *db.QuotaClaim {
+	quota := account.Quota
+	claim := &db.QuotaClaim{
+		Owner:          account.Owner,
+		PeriodStart:    quota.periodStart(now),
+		MaxCreations:   quota.MaxCreations,
+		MaxActiveLinks: quota.MaxActiveLinks,
+		Now:            now,
+	}
+	if account.Owner == "" {
+		claim.Owner = "ip:" + clientIP(r)
+		claim.MaxActiveLinks = 0
+	}
+	if !account.tracksCreations() && claim.MaxActiveLinks <= 0 {
+		return nil
+	}
+	return claim
+}
+
+// quotaRefusal describes the quota a store error from creating a link reports
+// as exceeded, or returns nil for other errors
+func quotaRefusal(err error) *quotaError {
+	switch err {
+	case db.ErrActiveLinkQuota:
+		return &quotaError{http.StatusForbidden, "active_link_quota_exceeded", "The quota of active links has been reached"}
+	case db.ErrCreationQuota:
+		return &quotaError{http.StatusTooManyRequests, "creation_quota_exceeded", "The quota of links created this period has been reached"}
+	}
+	return nil
+}
+
+// GetUsage reports the calling API key's consumption against its quota
+func (a *App) GetUsage(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	account, ok := a.requestAccount(r)
+	if !ok || account.Owner == "" {
+		writeError(w, http.StatusUnauthorized, "api_key_required", "A valid API key is required")
+		return
+	}
+	now := time.Now()
+	quota := account.Quota
+	usage := QuotaUsage{
+		Owner:       account.Owner,
+		ActiveLinks: UsageCount{Limit: quota.MaxActiveLinks},
+		Creations:   UsageCount{Limit: quota.MaxCreations},
+		PeriodStart: quota.periodStart(now),
+	}
+	usage.PeriodEnd = quota.periodEnd(usage.PeriodStart)
+	if quota.MaxTTL > 0 {
+		usage.MaxTTL = quota.MaxTTL.String()
+	}
+	var err error
+	if usage.ActiveLinks.Used, err = a.DB.CountActiveLinks(r.Context(), account.Owner, now); err != nil {
+		logger.WithField("owner", account.Owner).WithError(err).Error("Unable to count active links in GetUsage")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if usage.Creations.Used, err = a.DB.GetCreations(r.Context(), account.Owner, usage.PeriodStart); err != nil {
+		logger.WithField("owner", account.Owner).WithError(err).Error("Unable to get creations in GetUsage")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(&usage); err != nil {
+		logger.WithField("response", usage).WithError(err).Error("Unable to serialize GetUsage response")
+	}
+}
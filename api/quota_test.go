@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOwnerRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.MatchedBy(func(claim *db.QuotaClaim) bool {
+		return claim.Owner == "team-a" && claim.MaxActiveLinks == 2 && claim.MaxCreations == 2 && claim.PeriodStart.Day() == 1
+	}), mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	app := &App{
+		DB:       testDB,
+		Cache:    testCache,
+		Hostname: "test.com",
+		Accounts: map[string]Account{
+			"test-key": {Owner: "team-a", Quota: Quota{MaxActiveLinks: 2, MaxCreations: 2}},
+		},
+	}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\"}"
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "test-key")
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusCreated, w.Code, "within quota")
+	assert.Contains(w.Body.String(), "\"owner\":\"team-a\"")
+}
+
+func TestUnknownKeyRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{
+		DB:       &mocks.Store{},
+		Cache:    &mocks.Cache{},
+		Hostname: "test.com",
+	}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\"}"
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "unknown-key")
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	assert.Equal(http.StatusForbidden, w.Code, "unknown API key")
+	assert.Contains(w.Body.String(), "invalid_api_key")
+}
+
+func TestQuotaExceededRegisterShortener(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  Quota
+		ttl    string
+		dbErr  error
+		status int
+		code   string
+	}{
+		{"max ttl", Quota{MaxTTL: time.Hour}, "2h", nil, http.StatusForbidden, "ttl_quota_exceeded"},
+		{"active links", Quota{MaxActiveLinks: 2}, "10m", db.ErrActiveLinkQuota, http.StatusForbidden, "active_link_quota_exceeded"},
+		{"creations", Quota{MaxCreations: 5}, "10m", db.ErrCreationQuota, http.StatusTooManyRequests, "creation_quota_exceeded"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+			testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(test.dbErr)
+
+			app := &App{
+				DB:       testDB,
+				Cache:    &mocks.Cache{},
+				Hostname: "test.com",
+				Accounts: map[string]Account{"test-key": {Owner: "team-a", Quota: test.quota}},
+			}
+
+			payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"" + test.ttl + "\"}"
+			request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+			assert.NoError(err)
+			request.Header.Set("X-API-Key", "test-key")
+
+			w := httptest.NewRecorder()
+			app.RegisterShortener(w, request)
+
+			var apiErr APIError
+			assert.NoError(json.NewDecoder(w.Body).Decode(&apiErr))
+			assert.Equal(test.status, w.Code)
+			assert.Equal(test.code, apiErr.Code)
+			testDB.AssertNotCalled(t, "RecordAudit", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestQuotaClaim(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	app := &App{}
+	request := httptest.NewRequest("POST", "/", nil)
+	request.RemoteAddr = "203.0.113.7:4000"
+
+	owned := app.quotaClaim(request, &Account{Owner: "team-a", Quota: Quota{MaxActiveLinks: 2}}, now)
+	assert.Equal(&db.QuotaClaim{Owner: "team-a", PeriodStart: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), MaxActiveLinks: 2, Now: now}, owned)
+
+	anonymous := app.quotaClaim(request, &Account{Quota: Quota{MaxActiveLinks: 2, MaxCreations: 5}}, now)
+	assert.Equal("ip:203.0.113.7", anonymous.Owner, "anonymous creations are counted per client")
+	assert.Equal(5, anonymous.MaxCreations)
+	assert.Zero(anonymous.MaxActiveLinks, "anonymous links have no owner to count")
+
+	assert.Nil(app.quotaClaim(request, &Account{Quota: Quota{MaxActiveLinks: 2}}, now), "nothing to count")
+}
+
+func TestGetUsage(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("CountActiveLinks", mock.Anything, "team-a", mock.Anything).Return(3, nil)
+	testDB.On("GetCreations", mock.Anything, "team-a", mock.Anything).Return(7, nil)
+
+	app := &App{
+		DB:    testDB,
+		Cache: &mocks.Cache{},
+		Accounts: map[string]Account{
+			"test-key": {Owner: "team-a", Quota: Quota{MaxActiveLinks: 10, MaxCreations: 20, MaxTTL: time.Hour}},
+		},
+	}
+
+	request, err := http.NewRequest("GET", "/api/v1/usage", nil)
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "test-key")
+
+	w := httptest.NewRecorder()
+	app.GetUsage(w, request)
+
+	var usage QuotaUsage
+	assert.NoError(json.NewDecoder(w.Body).Decode(&usage))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("team-a", usage.Owner)
+	assert.Equal(UsageCount{Used: 3, Limit: 10}, usage.ActiveLinks)
+	assert.Equal(UsageCount{Used: 7, Limit: 20}, usage.Creations)
+	assert.Equal(1, usage.PeriodStart.Day(), "calendar month period")
+	assert.Equal("1h0m0s", usage.MaxTTL)
+}
+
+func TestAnonymousGetUsage(t *testing.T) {
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+
+	request, err := http.NewRequest("GET", "/api/v1/usage", nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	app.GetUsage(w, request)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "usage requires an API key")
+}
+
+func TestQuotaPeriod(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	monthly := Quota{}
+	assert.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), monthly.periodStart(now))
+	assert.Equal(time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), monthly.periodEnd(monthly.periodStart(now)))
+
+	daily := Quota{Period: 24 * time.Hour}
+	assert.Equal(time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), daily.periodStart(now))
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Purposes scope signed values so one signed for a use is not accepted for another
+const (
+	purposeContinue   = "interstitial-continue"
+	purposeBulkDelete = "bulk-delete"
+)
+
+// processSigningKey signs values when the App has no SigningKey. It is random
+// per process, so what it signs only verifies on the replica that signed it and
+// only until that replica restarts.
+var processSigningKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func (a *App) signingKey() []byte {
+	if len(a.SigningKey) == 0 {
+		return processSigningKey
+	}
+	return a.SigningKey
+}
+
+// sign returns a value that proves the server issued it for the purpose and
+// parts, and that stops verifying after expires
+func (a *App) sign(purpose string, expires time.Time, parts ...string) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + a.mac(purpose, expiry, parts)
+}
+
+// verifySignature reports whether signed came from sign with the same purpose
+// and parts and has not expired
+func (a *App) verifySignature(signed, purpose string, now time.Time, parts ...string) bool {
+	fields := strings.SplitN(signed, ".", 2)
+	if len(fields) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(fields[1]), []byte(a.mac(purpose, fields[0], parts)))
+}
+
+func (a *App) mac(purpose, expiry string, parts []string) string {
+	mac := hmac.New(sha256.New, a.signingKey())
+	mac.Write([]byte(purpose + "\x00" + expiry))
+	for _, part := range parts {
+		mac.Write([]byte("\x00" + part))
+	}
+	return b64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Link states that stop a redirect, each has a page template of the same name
+const (
+	StateNotFound     = "not_found"
+	StateExpired      = "expired"
+	StateDisabled     = "disabled"
+	StateNotYetActive = "not_yet_active"
+	StateRateLimited  = "rate_limited"
+)
+
+// StatusPage holds what an error page shows
+type StatusPage struct {
+	Status  int
+	Code    string
+	Title   string
+	Message string
+	Token   string
+}
+
+var statusPages = map[string]StatusPage{
+	StateNotFound: {
+		Status:  http.StatusNotFound,
+		Title:   "Link not found",
+		Message: "There is no link here. Check that it was copied correctly.",
+	},
+	StateExpired: {
+		Status:  http.StatusGone,
+		Title:   "Link expired",
+		Message: "This link has expired and no longer goes anywhere.",
+	},
+	StateDisabled: {
+		Status:  http.StatusForbidden,
+		Title:   "Link disabled",
+		Message: "This link has been disabled.",
+	},
+	StateNotYetActive: {
+		Status:  http.StatusForbidden,
+		Title:   "Link not active yet",
+		Message: "This link has not been activated yet. Try again later.",
+	},
+	StateRateLimited: {
+		Status:  http.StatusTooManyRequests,
+		Title:   "Too many requests",
+		Message: "You have made too many requests. Wait a moment and try again.",
+	},
+}
+
+// writeStatus reports a link state as an HTML page to browsers and as an
+// APIError to everything else
+func (a *App) writeStatus(w http.ResponseWriter, r *http.Request, state, token string) {
+	page := statusPages[state]
+	page.Code = state
+	page.Token = token
+	if !acceptsHTML(r) {
+		writeError(w, page.Status, page.Code, page.Message)
+		return
+	}
+	a.renderPage(w, r, page.Status, state+".html", page)
+}
+
+// acceptsHTML reports whether the client asked for HTML, as browsers do
+func acceptsHTML(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			return true
+		}
+	}
+	return false
+}
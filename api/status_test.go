@@ -0,0 +1,293 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestStatusRedirectToURL(t *testing.T) {
+	expired := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		shortURL *db.ShortURL
+		dbErr    error
+		swept    bool
+		status   int
+		code     string
+	}{
+		{"not found", &db.ShortURL{}, db.ErrNotFound, false, http.StatusNotFound, StateNotFound},
+		{"expired", &db.ShortURL{Token: "testurl", URL: "https://www.example.com", Expiration: expired}, nil, false, http.StatusGone, StateExpired},
+		{"swept", &db.ShortURL{}, db.ErrNotFound, true, http.StatusGone, StateExpired},
+		{"disabled", &db.ShortURL{Token: "testurl", URL: "https://www.example.com", Status: db.StatusSuspended}, nil, false, http.StatusForbidden, StateDisabled},
+	}
+	for _, test := range tests {
+		for _, accept := range []string{browserAccept, "application/json"} {
+			t.Run(test.name+" "+accept, func(t *testing.T) {
+				assert := assert.New(t)
+
+				testDB := &mocks.Store{}
+				testDB.On("GetShortURL", mock.Anything, "testurl").Return(test.shortURL, test.dbErr)
+				testDB.On("TokenExpired", mock.Anything, "testurl").Return(test.swept, nil)
+				testCache := &mocks.Cache{}
+				testCache.On("GetURL", mock.Anything, "testurl").Return(nil, cache.ErrNotFound)
+
+				app := &App{DB: testDB, Cache: testCache}
+				app.InitRouter()
+
+				request, err := http.NewRequest("GET", "/testurl", nil)
+				assert.NoError(err)
+				request.Header.Set("Accept", accept)
+
+				w := httptest.NewRecorder()
+				app.Router.ServeHTTP(w, request)
+
+				assert.Equal(test.status, w.Code)
+				if accept == browserAccept {
+					assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+					assert.Contains(w.Body.String(), statusPages[test.code].Title)
+				} else {
+					var apiErr APIError
+					assert.NoError(json.NewDecoder(w.Body).Decode(&apiErr))
+					assert.Equal(test.code, apiErr.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestFallbackRedirectToURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+		Token:        "testurl",
+		URL:          "https://www.example.com/sale",
+		Expiration:   time.Now().Add(-time.Hour).Format(time.RFC3339),
+		FallbackURL:  "https://www.example.com/",
+		RedirectType: http.StatusMovedPermanently,
+	}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(nil, cache.ErrNotFound)
+	testCache.On("SetURL", mock.Anything, &cache.Shortener{Token: "testurl", URL: "https://www.example.com/", RedirectType: http.StatusMovedPermanently}, fallbackCacheTTL).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	app.pending.Wait()
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusMovedPermanently, w.Code)
+	assert.Equal("https://www.example.com/", w.Header().Get("Location"))
+}
+
+func TestUncachedRedirectToURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Expiration: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(nil, cache.ErrNotFound)
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool { return s.URL == "https://www.example.com" }), mock.Anything).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	app.pending.Wait()
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusFound, w.Code, "evicted link is cached again")
+	assert.Equal("https://www.example.com", w.Header().Get("Location"))
+}
+
+func TestUnknownVersionRedirectToURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Expiration: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	// What the cache returns for a record whose version byte is 2
+	testCache.On("GetURL", mock.Anything, "testurl").Return(nil, fmt.Errorf("%w: %d", cache.ErrUnknownVersion, 2))
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool { return s.URL == "https://www.example.com" }), mock.Anything).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	app.pending.Wait()
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusFound, w.Code, "a record from a newer replica is a miss")
+	assert.Equal("https://www.example.com", w.Header().Get("Location"))
+}
+
+func TestNotYetActiveRedirectToURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Activation: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, nil)
+
+	app := &App{DB: &mocks.Store{}, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+	request.Header.Set("Accept", browserAccept)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Contains(w.Body.String(), "Link not active yet")
+}
+
+func TestDisableSetLinkStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl", Status: db.StatusActive}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditStatus && e.Actor == "marketing" && strings.Contains(string(e.Before), "active") && strings.Contains(string(e.After), "disabled")
+	})).Return(nil)
+	testDB.On("SetStatus", mock.Anything, "testurl", mock.MatchedBy(func(c *db.StatusChange) bool {
+		return c.Status == db.StatusDisabled && c.Reason == "phishing" && c.Actor == "marketing" && !c.At.IsZero()
+	}), queuesEvents(webhook.LinkUpdated, "testurl")).Return(&db.ShortURL{Token: "testurl", Status: db.StatusDisabled, StatusReason: "phishing", StatusActor: "marketing"}, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, "testurl").Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache, Accounts: map[string]Account{"key": {Owner: "marketing"}}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/testurl/status", strings.NewReader("{\"status\": \"disabled\", \"reason\": \"phishing\"}"))
+	assert.NoError(err)
+	request.Header.Set("X-API-Key", "key")
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"status_reason\":\"phishing\"")
+}
+
+func TestEnableSetLinkStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("SetStatus", mock.Anything, "testurl", mock.Anything, mock.Anything).Return(&db.ShortURL{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Expiration: time.Now().Add(time.Hour).Format(time.RFC3339),
+		Status:     db.StatusActive,
+	}, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool {
+		return s.Token == "testurl"
+	}), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/testurl/status", strings.NewReader("{\"status\": \"active\"}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestInvalidSetLinkStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/testurl/status", strings.NewReader("{\"status\": \"deleted\"}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_status")
+}
+
+func TestNotFoundSetLinkStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{}, db.ErrNotFound)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PUT", "/testurl/status", strings.NewReader("{\"status\": \"suspended\"}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestAcceptsHTML(t *testing.T) {
+	tests := map[string]bool{
+		browserAccept:      true,
+		"application/json": false,
+		"*/*":              false,
+		"":                 false,
+		"text/html; q=0.5": true,
+	}
+	for accept, want := range tests {
+		request := httptest.NewRequest("GET", "/testurl", nil)
+		request.Header.Set("Accept", accept)
+		assert.Equal(t, want, acceptsHTML(request), accept)
+	}
+}
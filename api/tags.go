@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxTags           = 20
+	maxFolderLength   = 100
+	defaultLinksLimit = 100
+	maxLinksLimit     = 1000
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,49}$`)
+
+// TagPayload represents a payload to rename a tag
+type TagPayload struct {
+	Name string `json:"name"`
+}
+
+// ListLinks lists the shorteners matching the owner, tag, folder, domain,
+// created_after, created_before, expires_after and expires_before query parameters
+func (a *App) ListLinks(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	filter, err := linkFilterFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	limit, offset, err := pageFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	shortURLs, err := a.DB.ListLinks(r.Context(), filter, limit, offset)
+	if err != nil {
+		logger.WithField("filter", filter).WithError(err).Error("Unable to list ShortURLs from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(shortURLs); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListLinks response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// pageFromQuery parses the limit and offset query parameters of a listing
+func pageFromQuery(r *http.Request) (int, int, error) {
+	query := r.URL.Query()
+	limit, offset := defaultLinksLimit, 0
+	var err error
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxLinksLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxLinksLimit))
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// ListTags lists every tag with how many shorteners have it
+func (a *App) ListTags(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	tags, err := a.DB.ListTags(r.Context())
+	if err != nil {
+		logger.WithError(err).Error("Unable to list tags from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(tags); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListTags response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// RenameTag renames the specified tag on every shortener that has it
+func (a *App) RenameTag(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	tag := normalizeTag(mux.Vars(r)["tag"])
+	var payload TagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	name := normalizeTag(payload.Name)
+	if !tagPattern.MatchString(name) {
+		writeError(w, http.StatusBadRequest, "invalid_tags", "tags must be 1 to 50 letters, digits, '.', '_' or '-'")
+		return
+	}
+	err := a.DB.RenameTag(r.Context(), tag, name)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err == db.ErrTagExists {
+		writeError(w, http.StatusConflict, "tag_exists", "a tag named "+strconv.Quote(name)+" already exists")
+		return
+	}
+	if err != nil {
+		logger.WithField("tag", tag).WithError(err).Error("Unable to rename tag in RenameTag")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditTagRename, "", map[string]string{"tag": tag}, map[string]string{"tag": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteTag removes the specified tag from every shortener that has it
+func (a *App) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	tag := normalizeTag(mux.Vars(r)["tag"])
+	err := a.DB.DeleteTag(r.Context(), tag)
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("tag", tag).WithError(err).Error("Unable to delete tag in DeleteTag")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditTagDelete, "", map[string]string{"tag": tag}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFolders lists every folder with how many shorteners are in it
+func (a *App) ListFolders(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	folders, err := a.DB.ListFolders(r.Context())
+	if err != nil {
+		logger.WithError(err).Error("Unable to list folders from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(folders); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListFolders response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// normalizeTags lower cases and de-duplicates tags, and checks they are valid
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, errors.New("tags must be 1 to 50 letters, digits, '.', '_' or '-'")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTags {
+		return nil, errors.New("a link can have at most " + strconv.Itoa(maxTags) + " tags")
+	}
+	return normalized, nil
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// validFolder reports whether folder is an acceptable folder name, empty means none
+func validFolder(folder string) bool {
+	return utf8.RuneCountInString(folder) <= maxFolderLength && strings.TrimSpace(folder) == folder
+}
+
+// linkFilterFromQuery reads a LinkFilter from the query parameters of the request
+func linkFilterFromQuery(r *http.Request) (*db.LinkFilter, error) {
+	query := r.URL.Query()
+	filter := &db.LinkFilter{
+		Owner:  query.Get("owner"),
+		Tag:    normalizeTag(query.Get("tag")),
+		Folder: query.Get("folder"),
+		Domain: query.Get("domain"),
+	}
+	times := map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"expires_after":  &filter.ExpiresAfter,
+		"expires_before": &filter.ExpiresBefore,
+	}
+	for name, dest := range times {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New(name + " must be an RFC 3339 time")
+			}
+			*dest = &t
+		}
+	}
+	return filter, nil
+}
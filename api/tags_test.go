@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestListLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("ListLinks", mock.Anything, mock.MatchedBy(func(f *db.LinkFilter) bool {
+		return f.Tag == "spring" && f.Folder == "Launch" && f.CreatedAfter != nil
+	}), 10, 20).Return(db.ShortURLS{{Token: "testurl", Folder: "Launch", Tags: []string{"spring"}}}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/links?tag=Spring&folder=Launch&created_after=2026-01-01T00:00:00Z&limit=10&offset=20", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"tags\":[\"spring\"]")
+}
+
+func TestInvalidFilterListLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	for _, query := range []string{"created_after=yesterday", "limit=0", "offset=-1"} {
+		request, err := http.NewRequest("GET", "/api/v1/links?"+query, nil)
+		assert.NoError(err)
+
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, request)
+
+		assert.Equal(http.StatusBadRequest, w.Code, query)
+		assert.Contains(w.Body.String(), "invalid_filter", query)
+	}
+}
+
+func TestTagFilterGetStats(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("CollectStats", mock.Anything, mock.MatchedBy(func(f *db.LinkFilter) bool {
+		return f.Tag == "spring"
+	})).Return(&db.Stats{
+		TotalURLs:      2,
+		TotalRedirects: 7,
+		Tags:           map[string]db.TagStats{"spring": {URLs: 2, Redirects: 7}},
+	}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/admin/stats?tag=spring", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"spring\":{\"urls\":2")
+}
+
+func TestTagsRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.MatchedBy(func(s *db.ShortURL) bool {
+		return s.Folder == "Launch" && reflect.DeepEqual(s.Tags, []string{"spring", "email"})
+	}), mock.Anything, mock.Anything).Return(nil)
+
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache, Hostname: "test.com"}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"folder\": \"Launch\", \"tags\": [\"Spring\", \" email\", \"spring\"]}"
+
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusCreated, w.Code)
+}
+
+func TestInvalidTagsRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}, Hostname: "test.com"}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"tags\": [\"no spaces\"]}"
+
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_tags")
+}
+
+func TestConflictRenameTag(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("RenameTag", mock.Anything, "spring", "summer").Return(db.ErrTagExists)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PATCH", "/api/v1/tags/spring", strings.NewReader("{\"name\": \"Summer\"}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Contains(w.Body.String(), "tag_exists")
+}
+
+func TestDeleteTag(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("DeleteTag", mock.Anything, "spring").Return(nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditTagDelete
+	})).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("DELETE", "/api/v1/tags/spring", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusNoContent, w.Code)
+}
+
+func TestListFolders(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("ListFolders", mock.Anything).Return([]db.FolderCount{{Name: "Launch", URLs: 3}}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/folders", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"Launch\"")
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert := assert.New(t)
+
+	tags, err := normalizeTags([]string{" Spring", "spring", "q1-2026"})
+	assert.NoError(err)
+	assert.Equal([]string{"spring", "q1-2026"}, tags)
+
+	_, err = normalizeTags([]string{""})
+	assert.Error(err)
+}
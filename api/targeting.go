@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/targeting"
+)
+
+const (
+	variantCookiePrefix = "snip_variant_"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// client describes the visitor from their User-Agent and, when a GeoIP database
+// is configured and usable, their location
+func (a *App) client(r *http.Request) targeting.Client {
+	client := targeting.ParseUserAgent(r.UserAgent())
+	if a.GeoIP == nil {
+		return client
+	}
+	location, err := a.GeoIP.Locate(net.ParseIP(clientIP(r)))
+	if err != nil {
+		return client
+	}
+	client.Country = location.Country
+	client.Region = location.Region
+	return client
+}
+
+// target picks the URL a request for link is sent to: the first targeting rule
+// the client matches, else the client's variant of a split link, else the link's
+// URL. It also returns the name of the variant, if one was used.
+func (a *App) target(w http.ResponseWriter, r *http.Request, link *cache.Shortener, client targeting.Client) (string, string) {
+	if target, ok := link.Rules.Destination(client); ok {
+		return target, ""
+	}
+	if len(link.Variants) == 0 {
+		return link.URL, ""
+	}
+	cookieName := variantCookiePrefix + link.Token
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		if variant, ok := link.Variants.Find(cookie.Value); ok {
+			return variant.URL, variant.Name
+		}
+	}
+	variant := link.Variants.Pick(link.Token + "|" + clientIP(r) + "|" + r.UserAgent())
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    variant.Name,
+		Path:     "/" + link.Token,
+		MaxAge:   int(variantCookieMaxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return variant.URL, variant.Name
+}
+
+// destination builds the URL a request for link is redirected to from its target
+func (a *App) destination(link *cache.Shortener, target string, query url.Values, path string) (string, error) {
+	destination := target
+	if len(link.UTM) > 0 {
+		tagged, err := utmURL(destination, link.UTM)
+		if err != nil {
+			return "", err
+		}
+		destination = tagged
+	}
+	if !link.Passthrough {
+		return destination, nil
+	}
+	return passthroughURL(destination, path, query, a.queryPrecedence(link))
+}
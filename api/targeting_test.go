@@ -0,0 +1,251 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/geoip"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/targeting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTargetedRedirectToURL(t *testing.T) {
+	human := false
+	link := cache.Shortener{
+		Token: "testurl",
+		URL:   "https://www.example.com",
+		Rules: targeting.Rules{
+			{OS: targeting.OSIOS, Bot: &human, URL: "https://apps.apple.com/app/id1"},
+			{OS: targeting.OSAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+		},
+		UTM:         map[string]string{"utm_source": "qr"},
+		Passthrough: true,
+	}
+	tests := []struct {
+		name      string
+		userAgent string
+		location  string
+	}{
+		{"ios", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "https://apps.apple.com/app/id1?utm_source=qr"},
+		{"android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", "https://play.google.com/store/apps/details?id=app&utm_source=qr"},
+		{"fallback", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", "https://www.example.com?utm_source=qr"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testCache := &mocks.Cache{}
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&link, nil)
+
+			app := &App{DB: testDB, Cache: testCache}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", "/testurl", nil)
+			assert.NoError(err)
+			request.Header.Set("User-Agent", test.userAgent)
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(http.StatusFound, w.Code)
+			assert.Equal(test.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestInvalidRulesRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}, Hostname: "test.com"}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"rules\": [{\"os\": \"beos\", \"url\": \"http://www.example.com/beos\"}]}"
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_rules")
+}
+
+type testLocator map[string]geoip.Location
+
+func (l testLocator) Locate(ip net.IP) (geoip.Location, error) {
+	location, ok := l[ip.String()]
+	if !ok {
+		return geoip.Location{}, geoip.ErrUnavailable
+	}
+	return location, nil
+}
+
+func TestGeoTargetedRedirectToURL(t *testing.T) {
+	link := cache.Shortener{
+		Token: "testurl",
+		URL:   "https://www.example.com",
+		Rules: targeting.Rules{
+			{Country: "DE", URL: "https://www.example.de"},
+		},
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		location   string
+		country    string
+	}{
+		{"located", "192.0.2.1:1234", "https://www.example.de", "DE"},
+		{"other country", "192.0.2.2:1234", "https://www.example.com", "FR"},
+		{"unavailable", "192.0.2.3:1234", "https://www.example.com", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testDB.On("IncrementClicks", mock.Anything, "testurl", db.DimensionCountry, mock.Anything).Return(nil)
+			testCache := &mocks.Cache{}
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&link, nil)
+
+			app := &App{
+				DB:    testDB,
+				Cache: testCache,
+				GeoIP: testLocator{
+					"192.0.2.1": {Country: "DE"},
+					"192.0.2.2": {Country: "FR"},
+				},
+			}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", "/testurl", nil)
+			assert.NoError(err)
+			request.RemoteAddr = test.remoteAddr
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(http.StatusFound, w.Code)
+			assert.Equal(test.location, w.Header().Get("Location"))
+			if test.country != "" {
+				testDB.AssertCalled(t, "IncrementClicks", mock.Anything, "testurl", db.DimensionCountry, test.country)
+			} else {
+				testDB.AssertNotCalled(t, "IncrementClicks", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestVariantRedirectToURL(t *testing.T) {
+	link := cache.Shortener{
+		Token: "testurl",
+		URL:   "https://www.example.com",
+		Variants: targeting.Variants{
+			{Name: "control", URL: "https://www.example.com/a", Weight: 1},
+			{Name: "treatment", URL: "https://www.example.com/b", Weight: 1},
+		},
+	}
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"assigned", ""},
+		{"sticky cookie", "treatment"},
+		{"stale cookie", "removed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			testDB := &mocks.Store{}
+			testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+			testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+			testDB.On("IncrementClicks", mock.Anything, "testurl", db.DimensionVariant, mock.Anything).Return(nil)
+			testCache := &mocks.Cache{}
+			testCache.On("GetURL", mock.Anything, "testurl").Return(&link, nil)
+
+			app := &App{DB: testDB, Cache: testCache}
+			app.InitRouter()
+
+			request, err := http.NewRequest("GET", "/testurl", nil)
+			assert.NoError(err)
+			if test.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: "snip_variant_testurl", Value: test.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, request)
+			app.pending.Wait()
+
+			assert.Equal(http.StatusFound, w.Code)
+			variant, ok := link.Variants.Find(test.cookie)
+			if ok {
+				assert.Equal(variant.URL, w.Header().Get("Location"))
+				assert.Empty(w.Result().Cookies(), "an assigned variant is kept")
+			} else {
+				cookies := w.Result().Cookies()
+				assert.Len(cookies, 1)
+				variant, ok = link.Variants.Find(cookies[0].Value)
+				assert.True(ok)
+				assert.Equal(variant.URL, w.Header().Get("Location"))
+			}
+			testDB.AssertCalled(t, "IncrementClicks", mock.Anything, "testurl", db.DimensionVariant, variant.Name)
+		})
+	}
+}
+
+func TestRulesTakePrecedenceOverVariants(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{
+		Token:    "testurl",
+		URL:      "https://www.example.com",
+		Rules:    targeting.Rules{{Device: targeting.DeviceOther, URL: "https://www.example.com/other"}},
+		Variants: targeting.Variants{{Name: "a", URL: "https://www.example.com/a", Weight: 1}},
+	}, nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	app.pending.Wait()
+
+	assert.Equal("https://www.example.com/other", w.Header().Get("Location"))
+	testDB.AssertNotCalled(t, "IncrementClicks", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestInvalidVariantsRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}, Hostname: "test.com"}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"variants\": [{\"name\": \"a\", \"url\": \"http://www.example.com/a\", \"weight\": 0}]}"
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_variants")
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/metrics"
+	"github.com/derek-elliott/url-shortener/tracing"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// RestorePayload represents a payload to restore shorteners from the trash
+type RestorePayload struct {
+	Tokens []string `json:"tokens"`
+}
+
+// RestoreResult reports which tokens a bulk restore took out of the trash
+type RestoreResult struct {
+	Restored []string `json:"restored"`
+	NotFound []string `json:"not_found"`
+}
+
+// ListTrash lists the deleted shorteners that can still be restored, most
+// recently deleted first, paged by the limit and offset query parameters
+func (a *App) ListTrash(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	limit, offset, err := pageFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	shortURLs, err := a.DB.ListDeleted(r.Context(), limit, offset)
+	if err != nil {
+		logger.WithError(err).Error("Unable to list deleted ShortURLs from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(shortURLs); err != nil {
+		logger.WithField("response", shortURLs).WithError(err).Error("Unable to serialize ListTrash response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// RestoreURL takes the specified shortener out of the trash
+func (a *App) RestoreURL(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	token := mux.Vars(r)["token"]
+	restored, err := a.restore(r.Context(), []string{token}, linkEvents(webhook.LinkRestored, linkPayload))
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to restore ShortURL in RestoreURL")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(restored) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	shortURL, err := a.DB.GetShortURL(r.Context(), token)
+	if err != nil {
+		logger.WithField("token", token).WithError(err).Error("Unable to retrieve restored ShortURL from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditRestore, token, nil, shortURL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(shortURL); err != nil {
+		logger.WithField("response", shortURL).WithError(err).Error("Unable to serialize RestoreURL response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// RestoreURLs takes the listed shorteners out of the trash, tokens that are not
+// in the trash are reported back rather than failing the request
+func (a *App) RestoreURLs(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	var payload RestorePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if len(payload.Tokens) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_tokens", "tokens must list at least one token")
+		return
+	}
+	restored, err := a.restore(r.Context(), payload.Tokens, linkEvents(webhook.LinkRestored, tokenPayload))
+	if err != nil {
+		logger.WithField("tokens", payload.Tokens).WithError(err).Error("Unable to restore ShortURLs in RestoreURLs")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	result := RestoreResult{Restored: restored, NotFound: []string{}}
+	found := map[string]bool{}
+	for _, token := range restored {
+		found[token] = true
+	}
+	for _, token := range payload.Tokens {
+		if !found[token] {
+			result.NotFound = append(result.NotFound, token)
+		}
+	}
+	if len(restored) > 0 {
+		a.audit(r, AuditRestore, "", nil, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.WithField("response", result).WithError(err).Error("Unable to serialize RestoreURLs response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// restore takes the tokens out of the trash, queueing the events, and caches them
+// again, returning the tokens that were restored. A failure to cache is logged,
+// the link is served from the database until it is cached on the next redirect.
+func (a *App) restore(ctx context.Context, tokens []string, events db.Events) ([]string, error) {
+	restored, err := a.DB.RestoreShortURLs(ctx, tokens, events)
+	if err != nil {
+		return nil, err
+	}
+	if restored == nil {
+		restored = []string{}
+	}
+	logger := LoggerFromContext(ctx)
+	now := time.Now()
+	for _, token := range restored {
+		logger.WithField("token", token).Info("ShortURL restored from trash")
+		shortURL, err := a.DB.GetShortURL(ctx, token)
+		if err != nil {
+			logger.WithField("token", token).WithError(err).Error("Unable to retrieve restored ShortURL from database")
+			continue
+		}
+		if err := a.refreshCache(ctx, shortURL, now); err != nil {
+			logger.WithField("token", token).WithError(err).Error("Unable to cache restored ShortURL")
+		}
+	}
+	return restored, nil
+}
+
+func (a *App) trashRetention() time.Duration {
+	if a.TrashRetention <= 0 {
+		return defaultTrashRetention
+	}
+	return a.TrashRetention
+}
+
+func (a *App) purgeTrash(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "purgeTrash")
+	defer span.End()
+	batchSize := a.SweepBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatchSize
+	}
+	before := time.Now().Add(-a.trashRetention())
+	count := 0
+	var purged []string
+	for {
+		tokens, err := a.DB.PurgeDeleted(ctx, before, batchSize)
+		if err != nil {
+			log.WithError(err).Error("Unable to purge deleted ShortURLs from database in purgeTrash")
+			break
+		}
+		purged = append(purged, tokens...)
+		count += len(tokens)
+		if len(tokens) < batchSize {
+			break
+		}
+	}
+	metrics.LinksPurged.Add(float64(count))
+	if count > 0 {
+		log.WithField("purged_urls", count).Info("Deleted URLs purged from trash")
+		a.recordAudit(ctx, &db.AuditEntry{
+			Action: AuditPurge,
+			Actor:  systemActor,
+			After:  snapshot(map[string]interface{}{"tokens": purged, "before": before}),
+		})
+	}
+}
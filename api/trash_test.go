@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestListTrash(t *testing.T) {
+	assert := assert.New(t)
+
+	deletedAt := time.Now().Add(-time.Hour)
+	testDB := &mocks.Store{}
+	testDB.On("ListDeleted", mock.Anything, defaultLinksLimit, 0).Return(db.ShortURLS{{Token: "testurl", DeletedAt: &deletedAt}}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/trash", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"deleted_at\"")
+}
+
+func TestPagedListTrash(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("ListDeleted", mock.Anything, 10, 20).Return(db.ShortURLS{}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/trash?limit=10&offset=20", nil)
+	assert.NoError(err)
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+
+	request, err = http.NewRequest("GET", "/api/v1/trash?limit=5000", nil)
+	assert.NoError(err)
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code, "limit above the maximum")
+	assert.Contains(w.Body.String(), "invalid_filter")
+}
+
+func TestRestoreURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("RestoreShortURLs", mock.Anything, []string{"testurl"}, queuesEvents(webhook.LinkRestored, "testurl")).Return([]string{"testurl"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditRestore && e.Token == "testurl"
+	})).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Expiration: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool {
+		return s.Token == "testurl"
+	}), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("POST", "/api/v1/trash/testurl/restore", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"token\":\"testurl\"")
+}
+
+func TestNotFoundRestoreURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("RestoreShortURLs", mock.Anything, []string{"testurl"}, mock.Anything).Return(nil, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("POST", "/api/v1/trash/testurl/restore", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestRestoreURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("RestoreShortURLs", mock.Anything, []string{"testurl1", "testurl2"}, queuesEvents(webhook.LinkRestored, "testurl2")).Return([]string{"testurl2"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("GetShortURL", mock.Anything, "testurl2").Return(&db.ShortURL{
+		Token:      "testurl2",
+		Expiration: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, "testurl2").Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("POST", "/api/v1/trash/restore", strings.NewReader("{\"tokens\": [\"testurl1\", \"testurl2\"]}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	var result RestoreResult
+	assert.NoError(json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal([]string{"testurl2"}, result.Restored)
+	assert.Equal([]string{"testurl1"}, result.NotFound)
+}
+
+func TestEmptyRestoreURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("POST", "/api/v1/trash/restore", strings.NewReader("{\"tokens\": []}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "invalid_tokens")
+}
+
+func TestPurgeTrash(t *testing.T) {
+	testDB := &mocks.Store{}
+	testDB.On("PurgeDeleted", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		cutoff := time.Now().Add(-48 * time.Hour)
+		return before.Sub(cutoff) < time.Minute && cutoff.Sub(before) < time.Minute
+	}), 2).Return([]string{"testurl1", "testurl2"}, nil).Once()
+	testDB.On("PurgeDeleted", mock.Anything, mock.AnythingOfType("time.Time"), 2).Return([]string{}, nil).Once()
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditPurge && e.Actor == systemActor && strings.Contains(string(e.After), "testurl2")
+	})).Return(nil)
+
+	app := &App{
+		DB:             testDB,
+		Cache:          &mocks.Cache{},
+		SweepBatchSize: 2,
+		TrashRetention: 48 * time.Hour,
+	}
+
+	app.purgeTrash(context.Background())
+
+	testDB.AssertExpectations(t)
+	testDB.AssertNumberOfCalls(t, "PurgeDeleted", 2)
+}
+
+func TestNotFoundDeleteURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{}, db.ErrNotFound)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("DELETE", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestReservedTokenRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(true, nil).Once()
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil).Once()
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+
+	request, err := http.NewRequest("POST", "/", strings.NewReader("{\"url\": \"http://www.example.com\", \"ttl\": \"10m\"}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	testDB.AssertNumberOfCalls(t, "TokenExists", 2)
+	assert.Equal(http.StatusCreated, w.Code)
+}
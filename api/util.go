@@ -2,7 +2,13 @@ package api
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	b64 "encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
 )
 
 // GenerateToken generates a cryptographically secure random byte array of length len and encodes it into a URL-safe base 64 string
@@ -13,3 +19,113 @@ func generateToken(len int) (string, error) {
 	}
 	return b64.URLEncoding.EncodeToString(b), nil
 }
+
+// clientIP returns the IP address of the client that sent the request, as
+// resolved by the ClientIP middleware, or the peer address outside it
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// peerIP returns the address of the connection the request came in on
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedIP walks X-Forwarded-For from the nearest hop while the hops are
+// trusted proxies and returns the first address a trusted proxy vouched for.
+// Without a trusted peer the header could be forged, so the peer is returned.
+func forwardedIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := peerIP(r)
+	if !trustedProxy(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func trustedProxy(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetworks parses CIDR ranges, accepting a bare IP as a single address
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: value}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// requestAPIKey returns the API key sent with the request, if any
+func requestAPIKey(r *http.Request) string {
+	return r.Header.Get("X-API-Key")
+}
+
+// requestActor names who made a request: the owner of its API key, or the
+// client IP when there is no known key
+func (a *App) requestActor(r *http.Request) string {
+	if account, ok := a.Accounts[requestAPIKey(r)]; ok && account.Owner != "" {
+		return account.Owner
+	}
+	return "ip:" + clientIP(r)
+}
+
+// hashKey hashes an API key so it is not stored or logged in the clear
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// APIError is the body sent with errors that carry a machine readable code
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&APIError{Code: code, Message: message})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,3 +12,35 @@ func TestGenerateToken(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotEqual(t, "", token, "Should not be an empty string")
 }
+
+func TestForwardedIP(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "192.0.2.1"})
+	assert.NoError(t, err)
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted peer cannot forge", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:4000", []string{"198.51.100.1, 192.0.2.1", "10.1.1.1"}, "198.51.100.1"},
+		{"spoofed entries before the client", "10.0.0.2:4000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"invalid hop", "10.0.0.2:4000", []string{"198.51.100.1, garbage"}, "10.0.0.2"},
+		{"only trusted hops", "10.0.0.2:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/testurl", nil)
+		request.RemoteAddr = test.peer
+		for _, value := range test.forwarded {
+			request.Header.Add("X-Forwarded-For", value)
+		}
+		assert.Equal(t, test.want, forwardedIP(request, trusted), test.name)
+	}
+}
+
+func TestInvalidParseNetworks(t *testing.T) {
+	_, err := ParseNetworks([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/url"
+)
+
+// utmURL sets the UTM parameters of a link on its destination, replacing any
+// the destination already carries
+func utmURL(destination string, utm map[string]string) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	for key, value := range utm {
+		params.Set(key, value)
+	}
+	target.RawQuery = mergeQuery(target.RawQuery, params, true)
+	return target.String(), nil
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUTMURL(t *testing.T) {
+	assert := assert.New(t)
+
+	tagged, err := utmURL("https://www.example.com/page?id=1&utm_source=old", map[string]string{"utm_source": "newsletter", "utm_medium": "email"})
+	assert.NoError(err)
+	assert.Equal("https://www.example.com/page?id=1&utm_source=newsletter&utm_medium=email", tagged, "existing parameters keep their place")
+}
+
+func TestUTMRedirectToURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+	testDB.On("IncrementRedirects", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(&cache.Shortener{
+		Token: "testurl",
+		URL:   "https://www.example.com/",
+		UTM:   map[string]string{"utm_campaign": "spring"},
+	}, nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/testurl", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+	app.pending.Wait()
+
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://www.example.com/?utm_campaign=spring", w.Header().Get("Location"))
+}
+
+func TestUTMRegisterShortener(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("TokenExists", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("CreateShortURL", mock.Anything, mock.MatchedBy(func(s *db.ShortURL) bool {
+		return s.URL == "http://www.example.com" && s.UTM.Source == "newsletter"
+	}), mock.Anything, mock.Anything).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool {
+		return s.URL == "http://www.example.com" && s.UTM["utm_source"] == "newsletter"
+	}), mock.Anything).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache, Hostname: "test.com"}
+
+	payload := "{\"url\": \"http://www.example.com\", \"ttl\": \"10m\", \"utm\": {\"source\": \"newsletter\"}}"
+	request, err := http.NewRequest("POST", "/", strings.NewReader(payload))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.RegisterShortener(w, request)
+
+	testDB.AssertExpectations(t)
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusCreated, w.Code)
+}
+
+func TestSuccessfulUpdateURL(t *testing.T) {
+	assert := assert.New(t)
+
+	updated := &db.ShortURL{
+		Token:      "testurl",
+		URL:        "https://www.example.com",
+		Expiration: time.Now().Add(time.Hour).Format(time.RFC3339),
+		UTM:        db.UTM{Campaign: "summer"},
+	}
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+	testDB.On("UpdateLink", mock.Anything, "testurl", &db.LinkUpdate{UTM: &db.UTM{Campaign: "summer"}}, queuesEvents(webhook.LinkUpdated, "testurl")).Return(updated, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditUpdate && e.Token == "testurl" && strings.Contains(string(e.After), "summer") && !strings.Contains(string(e.Before), "summer")
+	})).Return(nil)
+	testCache := &mocks.Cache{}
+	testCache.On("SetURL", mock.Anything, mock.MatchedBy(func(s *cache.Shortener) bool {
+		return s.Token == "testurl" && s.UTM["utm_campaign"] == "summer"
+	}), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PATCH", "/testurl", strings.NewReader("{\"utm\": {\"campaign\": \"summer\"}}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "\"campaign\":\"summer\"")
+}
+
+func TestExpiredUpdateURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{Token: "testurl"}, nil)
+	testDB.On("RecordAudit", mock.Anything, mock.Anything).Return(nil)
+	testDB.On("UpdateLink", mock.Anything, "testurl", mock.Anything, mock.Anything).Return(&db.ShortURL{
+		Token:      "testurl",
+		Expiration: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}, nil)
+	testCache := &mocks.Cache{}
+	testCache.On("DeleteURL", mock.Anything, "testurl").Return(nil)
+
+	app := &App{DB: testDB, Cache: testCache}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PATCH", "/testurl", strings.NewReader("{\"utm\": {}}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testCache.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestNotFoundUpdateURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{}, db.ErrNotFound)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("PATCH", "/testurl", strings.NewReader("{\"utm\": {}}"))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
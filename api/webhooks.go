@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/metrics"
+	"github.com/derek-elliott/url-shortener/tracing"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookInterval = 10 * time.Second
+	webhookBatchSize       = 100
+	webhookConcurrency     = 8
+	webhookTimeout         = 10 * time.Second
+	// webhookLease is how long a claimed batch is reserved for this process,
+	// comfortably longer than delivering a whole batch takes
+	webhookLease         = 5 * time.Minute
+	webhookSecretLength  = 24
+	eventIDLength        = 12
+	defaultDeliveryLimit = 100
+)
+
+// defaultWebhookClient delivers when the App has no WebhookClient, it refuses
+// internal addresses and redirects
+var defaultWebhookClient = webhook.NewClient(webhookTimeout)
+
+// defaultClickMilestones are the redirect counts that send a link.milestone event
+var defaultClickMilestones = []int{100, 1000, 10000, 100000, 1000000}
+
+// WebhookPayload represents a payload to subscribe to link events. A secret is
+// generated when none is given, and every event is sent when events is empty.
+type WebhookPayload struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// CreateWebhook subscribes a URL to link events, the response is the only time
+// the secret is returned
+func (a *App) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	var payload WebhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.WithError(err).Error("Unable to deserialize request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	target, err := url.Parse(payload.URL)
+	if err != nil || !webhook.ValidTarget(target) {
+		writeError(w, http.StatusBadRequest, "invalid_url", "url must be an absolute http or https URL to a public host")
+		return
+	}
+	for _, event := range payload.Events {
+		if !webhook.ValidEvent(event) {
+			writeError(w, http.StatusBadRequest, "invalid_events", "unknown event "+strconv.Quote(event))
+			return
+		}
+	}
+	if payload.Secret == "" {
+		if payload.Secret, err = generateToken(webhookSecretLength); err != nil {
+			logger.WithError(err).Error("Error generating webhook secret")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	subscription := db.Webhook{URL: payload.URL, Secret: payload.Secret, Events: payload.Events}
+	if err = a.DB.CreateWebhook(r.Context(), &subscription); err != nil {
+		logger.WithField("url", payload.URL).WithError(err).Error("Unable to create Webhook in database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditWebhookCreate, "", nil, withoutSecret(subscription))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(subscription); err != nil {
+		logger.WithError(err).Error("Unable to serialize CreateWebhook response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// ListWebhooks lists the webhook subscriptions without their secrets
+func (a *App) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	webhooks, err := a.DB.ListWebhooks(r.Context())
+	if err != nil {
+		logger.WithError(err).Error("Unable to list Webhooks from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(webhooks); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListWebhooks response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteWebhook unsubscribes the specified webhook, pending deliveries to it fail
+// on their next attempt
+func (a *App) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	subscription, err := a.DB.GetWebhook(r.Context(), uint(id))
+	if err == nil {
+		err = a.DB.DeleteWebhook(r.Context(), uint(id))
+	}
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("webhook_id", id).WithError(err).Error("Unable to delete Webhook in DeleteWebhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, AuditWebhookDelete, "", withoutSecret(*subscription), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries lists the most recent deliveries to the specified webhook, newest first
+func (a *App) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger := LoggerFromContext(r.Context())
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	limit := defaultDeliveryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+		limit = parsed
+	}
+	_, err := a.DB.GetWebhook(r.Context(), uint(id))
+	if err == db.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithField("webhook_id", id).WithError(err).Error("Unable to retrieve Webhook from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := a.DB.ListDeliveries(r.Context(), uint(id), limit)
+	if err != nil {
+		logger.WithField("webhook_id", id).WithError(err).Error("Unable to list deliveries from database")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(deliveries); err != nil {
+		logger.WithError(err).Error("Unable to serialize ListDeliveries response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// withoutSecret copies a subscription with its secret removed, for audit entries
+func withoutSecret(subscription db.Webhook) *db.Webhook {
+	subscription.Secret = ""
+	return &subscription
+}
+
+// linkEvents returns the events of a mutation, one of the type for each ShortURL
+// it changed with the data payload returns. The store queues them in the
+// transaction making the change, so they are sent if and only if it is committed.
+func linkEvents(eventType string, payload func(shortURL *db.ShortURL) interface{}) db.Events {
+	return func(changed []db.ShortURL) ([]*db.WebhookEvent, error) {
+		events := make([]*db.WebhookEvent, 0, len(changed))
+		for i := range changed {
+			event, err := newEvent(eventType, changed[i].Token, payload(&changed[i]))
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		return events, nil
+	}
+}
+
+// linkPayload sends the ShortURL as the event data
+func linkPayload(shortURL *db.ShortURL) interface{} {
+	return shortURL
+}
+
+// tokenPayload sends only the token as the event data, for changes made in bulk
+func tokenPayload(shortURL *db.ShortURL) interface{} {
+	return map[string]interface{}{"token": shortURL.Token}
+}
+
+// milestoneEvents returns a link.milestone event when counting a redirect
+// reached a click milestone
+func (a *App) milestoneEvents(changed []db.ShortURL) ([]*db.WebhookEvent, error) {
+	var events []*db.WebhookEvent
+	for _, shortURL := range changed {
+		if !a.reachedMilestone(shortURL.Redirects) {
+			continue
+		}
+		event, err := newEvent(webhook.LinkMilestone, shortURL.Token,
+			map[string]interface{}{"token": shortURL.Token, "redirects": shortURL.Redirects})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// newEvent builds an event about the ShortURL for the token with a new ID
+func newEvent(eventType, token string, data interface{}) (*db.WebhookEvent, error) {
+	id, err := generateToken(eventIDLength)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	payload, err := json.Marshal(webhook.Event{ID: id, Type: eventType, Token: token, CreatedAt: now, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return &db.WebhookEvent{
+		ID:        id,
+		Type:      eventType,
+		Token:     token,
+		Payload:   payload,
+		CreatedAt: now,
+	}, nil
+}
+
+// reachedMilestone reports whether a redirect count is a click milestone. It is
+// given the count returned by the atomic increment, which no two redirects share,
+// so each milestone is sent once however many redirects run at the same time.
+func (a *App) reachedMilestone(redirects int) bool {
+	milestones := a.ClickMilestones
+	if milestones == nil {
+		milestones = defaultClickMilestones
+	}
+	for _, milestone := range milestones {
+		if redirects == milestone {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) webhookInterval() time.Duration {
+	if a.WebhookInterval <= 0 {
+		return defaultWebhookInterval
+	}
+	return a.WebhookInterval
+}
+
+func (a *App) deliverWebhooks(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "deliverWebhooks")
+	defer span.End()
+	now := time.Now()
+	deliveries, err := a.DB.ClaimDeliveries(ctx, now, now.Add(webhookLease), webhookBatchSize)
+	if err != nil {
+		log.WithError(err).Error("Unable to claim due webhook deliveries from database in deliverWebhooks")
+		return
+	}
+	webhooks := map[uint]*db.Webhook{}
+	slots := make(chan struct{}, webhookConcurrency)
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if ctx.Err() != nil {
+			a.releaseDelivery(ctx, delivery)
+			continue
+		}
+		subscription, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			subscription, err = a.DB.GetWebhook(ctx, delivery.WebhookID)
+			if err != nil && err != db.ErrNotFound {
+				log.WithField("webhook_id", delivery.WebhookID).WithError(err).Error("Unable to retrieve Webhook from database")
+				continue
+			}
+			webhooks[delivery.WebhookID] = subscription
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			a.attemptDelivery(ctx, subscription, delivery, now)
+		}()
+	}
+	wg.Wait()
+}
+
+// attemptDelivery tries to deliver once and records the outcome, scheduling a
+// retry with exponential backoff until the attempts run out. An attempt cut
+// short by the shutdown is not counted, the delivery is released instead.
+func (a *App) attemptDelivery(ctx context.Context, subscription *db.Webhook, delivery *db.WebhookDelivery, now time.Time) {
+	logger := log.WithFields(log.Fields{"webhook_id": delivery.WebhookID, "delivery_id": delivery.ID, "event": delivery.Event})
+	if subscription == nil {
+		delivery.Status = db.DeliveryFailed
+		delivery.LastError = "webhook deleted"
+	} else {
+		client := a.WebhookClient
+		if client == nil {
+			client = defaultWebhookClient
+		}
+		status, err := webhook.Deliver(ctx, client, &webhook.Request{
+			URL:        subscription.URL,
+			Secret:     subscription.Secret,
+			Event:      delivery.Event,
+			DeliveryID: delivery.ID,
+			Payload:    delivery.Payload,
+		}, now)
+		if err != nil && ctx.Err() != nil {
+			a.releaseDelivery(ctx, delivery)
+			return
+		}
+		delivery.Attempts++
+		delivery.LastStatusCode = status
+		switch {
+		case err == nil:
+			delivery.Status = db.DeliveryDelivered
+			delivery.LastError = ""
+			delivered := now.UTC()
+			delivery.DeliveredAt = &delivered
+		case delivery.Attempts >= webhook.MaxAttempts:
+			delivery.Status = db.DeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			delivery.LastError = err.Error()
+			delivery.NextAttemptAt = now.Add(webhook.Backoff(delivery.Attempts))
+		}
+	}
+	result := delivery.Status
+	if result == db.DeliveryPending {
+		result = "retry"
+	}
+	metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+	if delivery.Status == db.DeliveryFailed {
+		logger.WithField("error", delivery.LastError).Warn("Giving up on webhook delivery")
+	}
+	if err := a.DB.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		logger.WithError(err).Error("Unable to record webhook delivery attempt")
+	}
+}
+
+// releaseDelivery gives up the claim on a delivery the shutdown kept from being
+// attempted, so the next run delivers it without having lost an attempt
+func (a *App) releaseDelivery(ctx context.Context, delivery *db.WebhookDelivery) {
+	if err := a.DB.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.WithFields(log.Fields{"webhook_id": delivery.WebhookID, "delivery_id": delivery.ID}).WithError(err).
+			Error("Unable to release webhook delivery")
+	}
+}
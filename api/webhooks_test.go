@@ -0,0 +1,421 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/derek-elliott/url-shortener/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("CreateWebhook", mock.Anything, mock.MatchedBy(func(w *db.Webhook) bool {
+		return w.URL == "https://hooks.example.com/snip" && w.Secret != "" && len(w.Events) == 1 && w.Events[0] == webhook.LinkDeleted
+	})).Return(nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditWebhookCreate && !strings.Contains(string(e.After), "secret")
+	})).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("POST", "/api/v1/webhooks", strings.NewReader(`{"url": "https://hooks.example.com/snip", "events": ["link.deleted"]}`))
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Contains(w.Body.String(), "\"secret\"")
+}
+
+func TestInvalidCreateWebhook(t *testing.T) {
+	tests := []struct {
+		payload string
+		code    string
+	}{
+		{`{"url": "hooks.example.com/snip"}`, "invalid_url"},
+		{`{"url": "ftp://hooks.example.com/snip"}`, "invalid_url"},
+		{`{"url": "http://169.254.169.254/latest/meta-data"}`, "invalid_url"},
+		{`{"url": "http://10.0.0.5:8080/"}`, "invalid_url"},
+		{`{"url": "http://localhost:6379/"}`, "invalid_url"},
+		{`{"url": "https://hooks.example.com/snip", "events": ["link.viewed"]}`, "invalid_events"},
+	}
+	for _, test := range tests {
+		assert := assert.New(t)
+
+		app := &App{DB: &mocks.Store{}, Cache: &mocks.Cache{}}
+		app.InitRouter()
+
+		request, err := http.NewRequest("POST", "/api/v1/webhooks", strings.NewReader(test.payload))
+		assert.NoError(err)
+
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, request)
+
+		assert.Equal(http.StatusBadRequest, w.Code, test.payload)
+		assert.Contains(w.Body.String(), test.code, test.payload)
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("ListWebhooks", mock.Anything).Return([]db.Webhook{{ID: 1, URL: "https://hooks.example.com/snip", Secret: "secret"}}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/webhooks", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "hooks.example.com")
+	assert.NotContains(w.Body.String(), "secret")
+}
+
+func TestNotFoundDeleteWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetWebhook", mock.Anything, uint(7)).Return(nil, db.ErrNotFound)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("DELETE", "/api/v1/webhooks/7", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetWebhook", mock.Anything, uint(7)).Return(&db.Webhook{ID: 7, URL: "https://hooks.example.com/snip", Secret: "secret"}, nil)
+	testDB.On("DeleteWebhook", mock.Anything, uint(7)).Return(nil)
+	testDB.On("RecordAudit", mock.Anything, mock.MatchedBy(func(e *db.AuditEntry) bool {
+		return e.Action == AuditWebhookDelete && strings.Contains(string(e.Before), "hooks.example.com") && !strings.Contains(string(e.Before), "secret")
+	})).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("DELETE", "/api/v1/webhooks/7", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusNoContent, w.Code)
+}
+
+func TestListDeliveries(t *testing.T) {
+	assert := assert.New(t)
+
+	testDB := &mocks.Store{}
+	testDB.On("GetWebhook", mock.Anything, uint(7)).Return(&db.Webhook{ID: 7}, nil)
+	testDB.On("ListDeliveries", mock.Anything, uint(7), 5).Return([]db.WebhookDelivery{
+		{ID: 3, WebhookID: 7, Event: webhook.LinkCreated, Status: db.DeliveryPending, Attempts: 2, LastStatusCode: 503},
+	}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}}
+	app.InitRouter()
+
+	request, err := http.NewRequest("GET", "/api/v1/webhooks/7/deliveries?limit=5", nil)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, request)
+
+	testDB.AssertExpectations(t)
+	assert.Equal(http.StatusOK, w.Code)
+	var deliveries []db.WebhookDelivery
+	assert.NoError(json.NewDecoder(w.Body).Decode(&deliveries))
+	assert.Len(deliveries, 1)
+	assert.Equal(503, deliveries[0].LastStatusCode)
+}
+
+// queuesEvents matches the events of a mutation that queue one event of the type
+// for each of the tokens, as the store would call them
+func queuesEvents(eventType string, tokens ...string) interface{} {
+	return mock.MatchedBy(func(events db.Events) bool {
+		changed := make([]db.ShortURL, len(tokens))
+		for i, token := range tokens {
+			changed[i].Token = token
+		}
+		queued, err := events(changed)
+		if err != nil || len(queued) != len(tokens) {
+			return false
+		}
+		for i, e := range queued {
+			if e.Type != eventType || e.Token != tokens[i] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestLinkEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	events, err := linkEvents(webhook.LinkUpdated, linkPayload)([]db.ShortURL{{Token: "testurl1"}, {Token: "testurl2"}})
+	assert.NoError(err)
+	assert.Len(events, 2)
+	for i, e := range events {
+		var event webhook.Event
+		assert.NoError(json.Unmarshal(e.Payload, &event))
+		assert.NotEmpty(e.ID)
+		assert.Equal(e.ID, event.ID)
+		assert.Equal(webhook.LinkUpdated, e.Type)
+		assert.Equal(webhook.LinkUpdated, event.Type)
+		assert.Equal([]string{"testurl1", "testurl2"}[i], e.Token)
+		assert.Equal(e.Token, event.Token)
+		assert.False(e.CreatedAt.IsZero())
+	}
+	assert.NotEqual(events[0].ID, events[1].ID)
+
+	events, err = linkEvents(webhook.LinkDeleted, tokenPayload)([]db.ShortURL{{Token: "testurl", URL: "https://www.example.com"}})
+	assert.NoError(err)
+	assert.Contains(string(events[0].Payload), `"data":{"token":"testurl"}`)
+}
+
+func TestMilestoneIncrementRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	var events db.Events
+	testDB := &mocks.Store{}
+	testDB.On("IncrementRedirects", mock.Anything, "testurl", mock.Anything).Run(func(args mock.Arguments) {
+		events = args.Get(2).(db.Events)
+	}).Return(10, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}, ClickMilestones: []int{10}}
+	app.incrementRedirects(context.Background(), "testurl")
+
+	testDB.AssertExpectations(t)
+	queued, err := events([]db.ShortURL{{Token: "testurl", Redirects: 10}})
+	assert.NoError(err)
+	assert.Len(queued, 1)
+	assert.Equal(webhook.LinkMilestone, queued[0].Type)
+	assert.Contains(string(queued[0].Payload), `"redirects":10`)
+	queued, err = events([]db.ShortURL{{Token: "testurl", Redirects: 11}})
+	assert.NoError(err)
+	assert.Empty(queued)
+}
+
+func TestConcurrentMilestoneIncrementRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	var redirects int64
+	var lock sync.Mutex
+	sent := map[string]int{}
+	testDB := &mocks.Store{}
+	testDB.On("IncrementRedirects", mock.Anything, "testurl", mock.Anything).Return(func(_ context.Context, token string, events db.Events) int {
+		count := int(atomic.AddInt64(&redirects, 1))
+		queued, err := events([]db.ShortURL{{Token: token, Redirects: count}})
+		assert.NoError(err)
+		lock.Lock()
+		defer lock.Unlock()
+		for _, e := range queued {
+			sent[string(e.Payload)]++
+		}
+		return count
+	}, nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}, ClickMilestones: []int{10, 25, 50}}
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.incrementRedirects(context.Background(), "testurl")
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(sent, 3)
+	for _, milestone := range []string{`"redirects":10`, `"redirects":25`, `"redirects":50`} {
+		found := 0
+		for payload, count := range sent {
+			if strings.Contains(payload, milestone) {
+				found += count
+			}
+		}
+		assert.Equal(1, found, milestone)
+	}
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(webhook.EventHeader) == webhook.LinkDeleted {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		event    string
+		attempts int
+		webhook  *db.Webhook
+		status   string
+		retry    bool
+	}{
+		{"delivered", webhook.LinkCreated, 0, &db.Webhook{ID: 1, URL: server.URL, Secret: "secret"}, db.DeliveryDelivered, false},
+		{"retried", webhook.LinkDeleted, 2, &db.Webhook{ID: 1, URL: server.URL, Secret: "secret"}, db.DeliveryPending, true},
+		{"exhausted", webhook.LinkDeleted, webhook.MaxAttempts - 1, &db.Webhook{ID: 1, URL: server.URL, Secret: "secret"}, db.DeliveryFailed, false},
+		{"webhook deleted", webhook.LinkCreated, 0, nil, db.DeliveryFailed, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			now := time.Now()
+			testDB := &mocks.Store{}
+			testDB.On("ClaimDeliveries", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), webhookBatchSize).Return([]db.WebhookDelivery{
+				{ID: 5, WebhookID: 1, Event: test.event, Payload: db.Snapshot(`{}`), Status: db.DeliveryPending, Attempts: test.attempts, NextAttemptAt: now},
+			}, nil)
+			if test.webhook != nil {
+				testDB.On("GetWebhook", mock.Anything, uint(1)).Return(test.webhook, nil)
+			} else {
+				testDB.On("GetWebhook", mock.Anything, uint(1)).Return(nil, db.ErrNotFound)
+			}
+			var saved *db.WebhookDelivery
+			testDB.On("UpdateDelivery", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				saved = args.Get(1).(*db.WebhookDelivery)
+			}).Return(nil)
+
+			app := &App{DB: testDB, Cache: &mocks.Cache{}, WebhookClient: server.Client()}
+			app.deliverWebhooks(context.Background())
+
+			assert.NotNil(saved)
+			assert.Equal(test.status, saved.Status)
+			assert.Equal(test.retry, saved.NextAttemptAt.After(now))
+			if test.status == db.DeliveryDelivered {
+				assert.NotNil(saved.DeliveredAt)
+				assert.Equal(http.StatusOK, saved.LastStatusCode)
+			} else {
+				assert.NotEmpty(saved.LastError)
+			}
+		})
+	}
+}
+
+func TestShutdownDeliverWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	started := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	testDB := &mocks.Store{}
+	testDB.On("ClaimDeliveries", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), webhookBatchSize).Return([]db.WebhookDelivery{
+		{ID: 5, WebhookID: 1, Event: webhook.LinkCreated, Payload: db.Snapshot(`{}`), Status: db.DeliveryPending, Attempts: 1, NextAttemptAt: now},
+		{ID: 6, WebhookID: 1, Event: webhook.LinkCreated, Payload: db.Snapshot(`{}`), Status: db.DeliveryPending, Attempts: 1, NextAttemptAt: now},
+	}, nil)
+	testDB.On("GetWebhook", mock.Anything, uint(1)).Return(&db.Webhook{ID: 1, URL: server.URL, Secret: "secret"}, nil)
+	var lock sync.Mutex
+	var saved []db.WebhookDelivery
+	testDB.On("UpdateDelivery", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		assert.NoError(args.Get(0).(context.Context).Err())
+		lock.Lock()
+		defer lock.Unlock()
+		saved = append(saved, *args.Get(1).(*db.WebhookDelivery))
+	}).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}, WebhookClient: server.Client()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.deliverWebhooks(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	assert.Len(saved, 2)
+	for _, delivery := range saved {
+		assert.Equal(db.DeliveryPending, delivery.Status)
+		assert.Equal(1, delivery.Attempts, "an attempt cut short by the shutdown is not counted")
+		assert.Equal(now, delivery.NextAttemptAt)
+		assert.Empty(delivery.LastError)
+	}
+}
+
+func TestConcurrentDeliverWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	healthy := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dead" {
+			select {
+			case <-healthy:
+			case <-time.After(2 * time.Second):
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(healthy)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	testDB := &mocks.Store{}
+	testDB.On("ClaimDeliveries", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), webhookBatchSize).Return([]db.WebhookDelivery{
+		{ID: 5, WebhookID: 1, Event: webhook.LinkCreated, Payload: db.Snapshot(`{}`), Status: db.DeliveryPending, NextAttemptAt: now},
+		{ID: 6, WebhookID: 2, Event: webhook.LinkCreated, Payload: db.Snapshot(`{}`), Status: db.DeliveryPending, NextAttemptAt: now},
+	}, nil)
+	testDB.On("GetWebhook", mock.Anything, uint(1)).Return(&db.Webhook{ID: 1, URL: server.URL + "/dead"}, nil)
+	testDB.On("GetWebhook", mock.Anything, uint(2)).Return(&db.Webhook{ID: 2, URL: server.URL + "/healthy"}, nil)
+	var lock sync.Mutex
+	statuses := map[uint]string{}
+	testDB.On("UpdateDelivery", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		delivery := args.Get(1).(*db.WebhookDelivery)
+		lock.Lock()
+		defer lock.Unlock()
+		statuses[delivery.ID] = delivery.Status
+	}).Return(nil)
+
+	app := &App{DB: testDB, Cache: &mocks.Cache{}, WebhookClient: server.Client()}
+	start := time.Now()
+	app.deliverWebhooks(context.Background())
+
+	assert.Less(time.Since(start), 2*time.Second, "a slow subscriber does not hold up the others")
+	assert.Equal(map[uint]string{5: db.DeliveryPending, 6: db.DeliveryDelivered}, statuses)
+}
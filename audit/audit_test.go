@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(os.WriteFile(path, []byte("{\"action\":\"create\"}\n"), 0600))
+
+	sink, err := NewFileSink(path)
+	assert.NoError(err)
+	assert.NoError(sink.Write(&db.AuditEntry{Action: "delete", Token: "testurl", Before: db.Snapshot(`{"token":"testurl"}`)}))
+	assert.NoError(sink.Write(&db.AuditEntry{Action: "status", Token: "testurl"}))
+	assert.NoError(sink.Close())
+
+	file, err := os.Open(path)
+	assert.NoError(err)
+	defer file.Close()
+	var actions []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry db.AuditEntry
+		assert.NoError(json.Unmarshal(scanner.Bytes(), &entry))
+		actions = append(actions, entry.Action)
+		if entry.Action == "delete" {
+			assert.JSONEq(`{"token":"testurl"}`, string(entry.Before))
+		}
+	}
+	assert.Equal([]string{"create", "delete", "status"}, actions)
+}
@@ -1,19 +1,38 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"time"
+
+	"github.com/derek-elliott/url-shortener/targeting"
 )
 
+// ErrNotFound is returned when no URL is cached for a token
+var ErrNotFound = errors.New("url not found in cache")
+
 // Cache defines a generic remote cache for holding shortened URLs
 type Cache interface {
 	InitCache(pass, host string, port int) error
-	SetURL(token, url string, ttl time.Duration) error
-	GetURL(token string) (*Shortener, error)
-	DeleteURL(token string) error
+	SetURL(ctx context.Context, shortener *Shortener, ttl time.Duration) error
+	GetURL(ctx context.Context, token string) (*Shortener, error)
+	DeleteURL(ctx context.Context, token string) error
+	Ping(ctx context.Context) error
+	Close() error
 }
 
-// Shortener holds the token, url map entry
+// Shortener holds the cached link data needed to redirect a token without
+// reading the store. Fields are encoded under short msgpack keys; add new
+// fields with new keys rather than reusing old ones.
 type Shortener struct {
-	Token string
-	URL   string
+	Token           string             `json:"token" msgpack:"-"`
+	URL             string             `json:"url" msgpack:"u"`
+	RedirectType    int                `json:"redirect_type,omitempty" msgpack:"r,omitempty"`
+	Passthrough     bool               `json:"passthrough,omitempty" msgpack:"p,omitempty"`
+	QueryPrecedence string             `json:"query_precedence,omitempty" msgpack:"q,omitempty"`
+	UTM             map[string]string  `json:"utm,omitempty" msgpack:"m,omitempty"`
+	Rules           targeting.Rules    `json:"rules,omitempty" msgpack:"t,omitempty"`
+	Variants        targeting.Variants `json:"variants,omitempty" msgpack:"v,omitempty"`
+	Interstitial    bool               `json:"interstitial,omitempty" msgpack:"i,omitempty"`
+	Activation      string             `json:"activation,omitempty" msgpack:"a,omitempty"`
 }
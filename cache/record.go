@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// recordVersion prefixes every encoded Shortener so the format can change
+// without breaking replicas that are still reading older entries
+const recordVersion byte = 1
+
+var (
+	// ErrUnknownVersion is returned when a cached record was written in a newer format
+	ErrUnknownVersion = errors.New("unknown cached record version")
+	// ErrCorrupt is returned when a cached record cannot be decoded
+	ErrCorrupt = errors.New("corrupt cached record")
+)
+
+// Unreadable reports whether err means a cached record exists but could not be
+// read. Callers treat it as a miss and rewrite the entry from the database.
+func Unreadable(err error) bool {
+	return errors.Is(err, ErrUnknownVersion) || errors.Is(err, ErrCorrupt)
+}
+
+// encodeShortener encodes the link data for a token as a version byte followed by msgpack
+func encodeShortener(shortener *Shortener) ([]byte, error) {
+	body, err := msgpack.Marshal(shortener)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{recordVersion}, body...), nil
+}
+
+// decodeShortener reads a cached record. Entries written before records were
+// versioned hold either JSON link data or the bare destination URL.
+func decodeShortener(token string, value []byte) (*Shortener, error) {
+	shortener := Shortener{}
+	switch {
+	case len(value) == 0:
+		return nil, ErrNotFound
+	case value[0] == recordVersion:
+		if err := msgpack.Unmarshal(value[1:], &shortener); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	case value[0] < ' ':
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, value[0])
+	case value[0] == '{':
+		if err := json.Unmarshal(value, &shortener); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	default:
+		shortener.URL = string(value)
+	}
+	shortener.Token = token
+	return &shortener, nil
+}
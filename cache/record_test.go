@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortenerRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	value, err := encodeShortener(&Shortener{Token: "testurl", URL: "https://www.example.com", RedirectType: http.StatusMovedPermanently})
+	assert.NoError(err)
+	assert.Equal(recordVersion, value[0], "version prefix")
+	assert.NotContains(string(value), "testurl", "token is the key, not part of the record")
+
+	shortener, err := decodeShortener("testurl", value)
+	assert.NoError(err)
+	assert.Equal(&Shortener{Token: "testurl", URL: "https://www.example.com", RedirectType: http.StatusMovedPermanently}, shortener)
+}
+
+func TestDecodeLegacyShortener(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  *Shortener
+	}{
+		{"plain url", "https://www.example.com", &Shortener{Token: "testurl", URL: "https://www.example.com"}},
+		{"json", `{"token":"testurl","url":"https://www.example.com","redirect_type":308}`, &Shortener{Token: "testurl", URL: "https://www.example.com", RedirectType: http.StatusPermanentRedirect}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shortener, err := decodeShortener("testurl", []byte(test.value))
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, shortener)
+		})
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	_, err := decodeShortener("testurl", []byte{2, 0x80})
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+	assert.True(t, Unreadable(err))
+}
+
+func TestDecodeCorruptShortener(t *testing.T) {
+	for _, value := range [][]byte{{recordVersion, 0xc1}, []byte(`{"url":`)} {
+		_, err := decodeShortener("testurl", value)
+		assert.ErrorIs(t, err, ErrCorrupt)
+		assert.True(t, Unreadable(err))
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -26,28 +27,49 @@ func (c *RedisCache) InitCache(pass, host string, port int) error {
 	return nil
 }
 
-// SetURL sets the URL for a given token in Redis
-func (c *RedisCache) SetURL(token, url string, ttl time.Duration) error {
-	if err := c.client.Set(token, url, ttl).Err(); err != nil {
+// Client returns the underlying Redis client
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
+// SetURL stores the encoded link data for a token in Redis
+func (c *RedisCache) SetURL(ctx context.Context, shortener *Shortener, ttl time.Duration) error {
+	value, err := encodeShortener(shortener)
+	if err != nil {
+		return err
+	}
+	if err := c.client.WithContext(ctx).Set(shortener.Token, value, ttl).Err(); err != nil {
 		return err
 	}
 	return nil
 }
 
-// GetURL gets the URL for the given token from Redis
-func (c *RedisCache) GetURL(token string) (*Shortener, error) {
-	url, err := c.client.Get(token).Result()
+// GetURL gets the link data for the given token from Redis
+func (c *RedisCache) GetURL(ctx context.Context, token string) (*Shortener, error) {
+	value, err := c.client.WithContext(ctx).Get(token).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	shortener := Shortener{token, url}
-	return &shortener, nil
+	return decodeShortener(token, value)
 }
 
 // DeleteURL deletes the URL for the given token from Redis
-func (c *RedisCache) DeleteURL(token string) error {
-	if err := c.client.Del(token).Err(); err != nil {
+func (c *RedisCache) DeleteURL(ctx context.Context, token string) error {
+	if err := c.client.WithContext(ctx).Del(token).Err(); err != nil {
 		return err
 	}
 	return nil
 }
+
+// Ping checks that Redis is reachable
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.WithContext(ctx).Ping().Err()
+}
+
+// Close closes the connection to Redis
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
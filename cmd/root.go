@@ -1,11 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/derek-elliott/url-shortener/api"
+	"github.com/derek-elliott/url-shortener/audit"
 	"github.com/derek-elliott/url-shortener/cache"
 	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/geoip"
+	"github.com/derek-elliott/url-shortener/leader"
+	"github.com/derek-elliott/url-shortener/metrics"
+	"github.com/derek-elliott/url-shortener/ratelimit"
+	"github.com/derek-elliott/url-shortener/tracing"
 	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,10 +25,30 @@ import (
 )
 
 type config struct {
-	Hostname string
-	Port     int
-	DB       dbConfig
-	Cache    cacheConfig
+	Hostname        string
+	Port            int
+	RedirectType    int      `mapstructure:"redirect_type"`
+	QueryPrecedence string   `mapstructure:"query_precedence"`
+	SigningKey      string   `mapstructure:"signing_key"`
+	TrustedProxies  []string `mapstructure:"trusted_proxies"`
+	DB              dbConfig
+	Cache           cacheConfig
+	Sweeper         sweeperConfig
+	Trash           trashConfig
+	Audit           auditConfig
+	Webhooks        webhooksConfig
+	Leader          leaderConfig
+	Metrics         metricsConfig
+	Tracing         tracingConfig
+	AccessLog       accessLogConfig `mapstructure:"access_log"`
+	RateLimit       rateLimitConfig `mapstructure:"rate_limit"`
+	GeoIP           geoIPConfig     `mapstructure:"geoip"`
+	Interstitial    interstitialConfig
+	Templates       string
+	Accounts        []accountConfig
+	DefaultQuota    quotaConfig   `mapstructure:"default_quota"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	DrainDelay      time.Duration `mapstructure:"drain_delay"`
 }
 
 type dbConfig struct {
@@ -33,6 +65,89 @@ type cacheConfig struct {
 	Port int
 }
 
+type sweeperConfig struct {
+	Interval     time.Duration
+	BatchSize    int           `mapstructure:"batch_size"`
+	TombstoneTTL time.Duration `mapstructure:"tombstone_ttl"`
+}
+
+type trashConfig struct {
+	Retention time.Duration
+}
+
+type auditConfig struct {
+	File string
+}
+
+type webhooksConfig struct {
+	Interval        time.Duration
+	ClickMilestones []int `mapstructure:"click_milestones"`
+}
+
+type leaderConfig struct {
+	Backend string
+	Key     string
+	TTL     time.Duration
+}
+
+type metricsConfig struct {
+	Address string
+	Path    string
+}
+
+type tracingConfig struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string  `mapstructure:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+type accessLogConfig struct {
+	Format             string
+	RedirectSampleRate float64 `mapstructure:"redirect_sample_rate"`
+}
+
+type rateLimitConfig struct {
+	Backend  string
+	Policies map[string]ratelimit.Policy
+}
+
+type geoIPConfig struct {
+	Database       string
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+}
+
+type interstitialConfig struct {
+	Watchlist       []string
+	AllowedDomains  []string      `mapstructure:"allowed_domains"`
+	ContinueTTL     time.Duration `mapstructure:"continue_ttl"`
+	DomainsInterval time.Duration `mapstructure:"domains_interval"`
+}
+
+type accountConfig struct {
+	Owner  string
+	APIKey string `mapstructure:"api_key"`
+	Quota  quotaConfig
+}
+
+type quotaConfig struct {
+	MaxActiveLinks int           `mapstructure:"max_active_links"`
+	MaxCreations   int           `mapstructure:"max_creations"`
+	Period         time.Duration `mapstructure:"period"`
+	MaxTTL         time.Duration `mapstructure:"max_ttl"`
+}
+
+func (q quotaConfig) quota() api.Quota {
+	return api.Quota{
+		MaxActiveLinks: q.MaxActiveLinks,
+		MaxCreations:   q.MaxCreations,
+		Period:         q.Period,
+		MaxTTL:         q.MaxTTL,
+	}
+}
+
 // RootCmd is the root command for the command line tool to start Snip
 var RootCmd = &cobra.Command{
 	Use: "snip",
@@ -52,6 +167,21 @@ func init() {
 }
 
 func startServer(cmd *cobra.Command, args []string) {
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:    conf.Tracing.Exporter,
+		Endpoint:    conf.Tracing.Endpoint,
+		Insecure:    conf.Tracing.Insecure,
+		ServiceName: conf.Tracing.ServiceName,
+		SampleRatio: conf.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Unable to set up tracing")
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithError(err).Error("Unable to flush traces")
+		}
+	}()
 	db := db.GormStore{}
 	if err := db.InitDB(conf.DB.User, conf.DB.Pass, conf.DB.Name, conf.DB.Host, conf.DB.Port); err != nil {
 		log.WithError(err).Fatal("Unable to set up database")
@@ -60,8 +190,167 @@ func startServer(cmd *cobra.Command, args []string) {
 	if err := cache.InitCache(conf.Cache.Pass, conf.Cache.Host, conf.Cache.Port); err != nil {
 		log.WithError(err).Fatal("Unable to set up cache")
 	}
-	app := api.App{DB: &db, Cache: &cache, Hostname: conf.Hostname}
-	log.Fatal(app.Run(conf.Port))
+	monitor, err := newLeaderMonitor(&db, &cache)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to set up leader election")
+	}
+	limiter, err := newRateLimiter(&cache)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to set up rate limiting")
+	}
+	if conf.RedirectType != 0 && !api.ValidRedirectType(conf.RedirectType) {
+		log.WithField("redirect_type", conf.RedirectType).Fatal("Unsupported default redirect type")
+	}
+	if conf.QueryPrecedence != "" && !api.ValidQueryPrecedence(conf.QueryPrecedence) {
+		log.WithField("query_precedence", conf.QueryPrecedence).Fatal("Unsupported query precedence")
+	}
+	templates, err := api.LoadTemplates(conf.Templates)
+	if err != nil {
+		log.WithField("templates", conf.Templates).WithError(err).Fatal("Unable to load page templates")
+	}
+	if conf.SigningKey == "" {
+		log.Warn("No signing_key configured, signed links only work on the replica that issued them until it restarts")
+	}
+	trustedProxies, err := api.ParseNetworks(conf.TrustedProxies)
+	if err != nil {
+		log.WithField("trusted_proxies", conf.TrustedProxies).WithError(err).Fatal("Unable to parse trusted proxies")
+	}
+	accounts := map[string]api.Account{}
+	for _, account := range conf.Accounts {
+		accounts[account.APIKey] = api.Account{Owner: account.Owner, Quota: account.Quota.quota()}
+	}
+	app := api.App{
+		DB:              tracing.InstrumentStore(metrics.InstrumentStore(&db)),
+		Cache:           tracing.InstrumentCache(metrics.InstrumentCache(&cache)),
+		Hostname:        conf.Hostname,
+		RedirectType:    conf.RedirectType,
+		QueryPrecedence: conf.QueryPrecedence,
+		SweepInterval:   conf.Sweeper.Interval,
+		SweepBatchSize:  conf.Sweeper.BatchSize,
+		TombstoneTTL:    conf.Sweeper.TombstoneTTL,
+		TrashRetention:  conf.Trash.Retention,
+		WebhookInterval: conf.Webhooks.Interval,
+		ClickMilestones: conf.Webhooks.ClickMilestones,
+		Leader:          monitor,
+		AccessLog: &api.AccessLog{
+			Format:             conf.AccessLog.Format,
+			RedirectSampleRate: conf.AccessLog.RedirectSampleRate,
+		},
+		ShutdownTimeout: conf.ShutdownTimeout,
+		DrainDelay:      drainDelay(),
+		RateLimiter:     limiter,
+		RateLimits:      conf.RateLimit.Policies,
+		Interstitial: api.Interstitial{
+			Watchlist:       conf.Interstitial.Watchlist,
+			AllowedDomains:  conf.Interstitial.AllowedDomains,
+			ContinueTTL:     conf.Interstitial.ContinueTTL,
+			DomainsInterval: conf.Interstitial.DomainsInterval,
+		},
+		SigningKey:     []byte(conf.SigningKey),
+		Templates:      templates,
+		Accounts:       accounts,
+		TrustedProxies: trustedProxies,
+		DefaultQuota:   conf.DefaultQuota.quota(),
+		MetricsAddress: conf.Metrics.Address,
+		MetricsPath:    conf.Metrics.Path,
+	}
+	if conf.Audit.File != "" {
+		sink, err := audit.NewFileSink(conf.Audit.File)
+		if err != nil {
+			log.WithField("file", conf.Audit.File).WithError(err).Fatal("Unable to open audit log file")
+		}
+		defer sink.Close()
+		app.AuditSink = sink
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal stops the process without waiting for the drain
+		<-ctx.Done()
+		stop()
+	}()
+	if conf.GeoIP.Database != "" {
+		geoIP := newGeoIP(ctx)
+		defer geoIP.Close()
+		app.GeoIP = geoIP
+	}
+	if err := app.Run(ctx, conf.Port); err != nil {
+		log.WithError(err).Fatal("Snip stopped unexpectedly")
+	}
+	log.Info("Snip stopped")
+}
+
+// newGeoIP loads the GeoIP database and watches it for changes. A database that
+// cannot be loaded is not fatal, redirects use their default destinations.
+func newGeoIP(ctx context.Context) *geoip.Database {
+	database := geoip.NewDatabase(conf.GeoIP.Database, conf.GeoIP.MaxAge)
+	if err := database.Reload(); err != nil {
+		log.WithField("path", conf.GeoIP.Database).WithError(err).Warn("Unable to load GeoIP database, geo targeting is disabled until it loads")
+	}
+	interval := conf.GeoIP.ReloadInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go database.Watch(ctx, interval)
+	return database
+}
+
+// drainDelay is the configured drain_delay, where 0 turns the delay off, or 5s
+// when it is not set
+func drainDelay() time.Duration {
+	if !viper.IsSet("drain_delay") {
+		return 5 * time.Second
+	}
+	return conf.DrainDelay
+}
+
+func newLeaderMonitor(db *db.GormStore, cache *cache.RedisCache) (*leader.Monitor, error) {
+	ttl := conf.Leader.TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	key := conf.Leader.Key
+	if key == "" {
+		key = "snip:leader"
+	}
+	id, err := leader.NewID()
+	if err != nil {
+		return nil, err
+	}
+	var elector leader.Elector
+	switch conf.Leader.Backend {
+	case "redis":
+		elector = leader.NewRedisElector(cache.Client(), key, id, ttl)
+	case "postgres":
+		elector = leader.NewPostgresElector(db.Client(), key)
+	case "local":
+		log.Warn("Local leader election only coordinates a single replica, use redis or postgres when running more")
+		elector = leader.NewLocalLock(ttl).Elector(id)
+	case "":
+		return nil, fmt.Errorf("leader.backend is not set, use redis or postgres, or local for a single replica")
+	default:
+		return nil, fmt.Errorf("unknown leader election backend %q", conf.Leader.Backend)
+	}
+	log.WithFields(log.Fields{"backend": conf.Leader.Backend, "id": id}).Info("Leader election configured")
+	return &leader.Monitor{Elector: elector, Interval: ttl / 3}, nil
+}
+
+func newRateLimiter(cache *cache.RedisCache) (ratelimit.Limiter, error) {
+	for name, policy := range conf.RateLimit.Policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("rate_limit.policies.%s: %v", name, err)
+		}
+	}
+	switch conf.RateLimit.Backend {
+	case "":
+		return nil, nil
+	case "redis":
+		return ratelimit.NewRedisLimiter(cache.Client(), "snip:ratelimit:"), nil
+	case "memory":
+		return ratelimit.NewMemoryLimiter(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", conf.RateLimit.Backend)
+	}
 }
 
 func loadConfig() {
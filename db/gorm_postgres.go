@@ -1,9 +1,17 @@
 package db
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	// Blank import for postgres support
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 )
@@ -13,6 +21,19 @@ type GormStore struct {
 	client *gorm.DB
 }
 
+// sqlRunner runs raw SQL on the database or in a transaction, as *sql.DB and
+// *sql.Tx both do
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runnerOf returns what runs raw SQL for the Gorm handle, the transaction when
+// it is one
+func runnerOf(db *gorm.DB) sqlRunner {
+	return db.CommonDB().(sqlRunner)
+}
+
 // InitDB initializes the database
 func (s *GormStore) InitDB(user, pass, name, host string, port int) error {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=disable password=%s", host, port, user, name, pass)
@@ -20,22 +41,41 @@ func (s *GormStore) InitDB(user, pass, name, host string, port int) error {
 	if err != nil {
 		return err
 	}
-	db.AutoMigrate(&ShortURL{})
+	db.AutoMigrate(&ShortURL{}, &Usage{}, &Clicks{}, &AuditEntry{}, &Webhook{}, &WebhookDelivery{}, &Tag{}, &LinkTag{}, &InterstitialDomain{}, &Tombstone{})
 	s.client = db
 	return nil
 }
 
-// GetShortURL gets a the ShortURL for the given token from Postgres
-func (s *GormStore) GetShortURL(token string) (*ShortURL, error) {
+// Client returns the underlying database handle
+func (s *GormStore) Client() *sql.DB {
+	return s.client.DB()
+}
+
+// GetShortURL gets a the ShortURL for the given token from Postgres, or ErrNotFound
+func (s *GormStore) GetShortURL(ctx context.Context, token string) (*ShortURL, error) {
+	return s.getShortURL(ctx, s.client, token)
+}
+
+// getShortURL gets the ShortURL for the token with db, which may be a transaction
+func (s *GormStore) getShortURL(ctx context.Context, db *gorm.DB, token string) (*ShortURL, error) {
 	shortURL := ShortURL{}
-	if err := s.client.Where("token = ?", token).First(&shortURL).Error; err != nil {
+	err := db.Where("token = ?", token).First(&shortURL).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &shortURL, ErrNotFound
+	}
+	if err != nil {
 		return &shortURL, err
 	}
+	tags, err := s.tagsOf(ctx, runnerOf(db), []string{token})
+	if err != nil {
+		return &shortURL, err
+	}
+	shortURL.Tags = tags[token]
 	return &shortURL, nil
 }
 
 // GetAllURLTokens retrieves all URL tokens from Postgres
-func (s *GormStore) GetAllURLTokens() ([]string, error) {
+func (s *GormStore) GetAllURLTokens(ctx context.Context) ([]string, error) {
 	var shortURLs ShortURLS
 	var tokens []string
 	if err := s.client.Select("token").Find(&shortURLs).Error; err != nil {
@@ -47,47 +87,870 @@ func (s *GormStore) GetAllURLTokens() ([]string, error) {
 	return tokens, nil
 }
 
-// CreateShortURL creates the given ShortURL in Postgres
-func (s *GormStore) CreateShortURL(shortURL *ShortURL) error {
-	if err := s.client.Create(shortURL).Error; err != nil {
+// CreateShortURL creates the given ShortURL and its tags in Postgres, counting
+// it against the quota claim, if any, and queueing its events in the same transaction
+func (s *GormStore) CreateShortURL(ctx context.Context, shortURL *ShortURL, claim *QuotaClaim, events Events) error {
+	tx := s.client.Begin()
+	if claim != nil {
+		if err := s.claimQuota(tx, shortURL.Owner, claim); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Create(shortURL).Error; err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	if err := s.setTags(tx, shortURL.Token, shortURL.Tags); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("token = ?", shortURL.Token).Delete(&Tombstone{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.queueEvents(ctx, runnerOf(tx), events, []ShortURL{*shortURL}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 // UpdateShortURL updates the given ShortURL in Postgres
-func (s *GormStore) UpdateShortURL(shortURL *ShortURL) error {
+func (s *GormStore) UpdateShortURL(ctx context.Context, shortURL *ShortURL) error {
 	if err := s.client.Model(shortURL).Updates(shortURL).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-// DeleteShortURL Deletes the given ShortURL from Postgres
-func (s *GormStore) DeleteShortURL(token string) error {
-	shortURL, err := s.GetShortURL(token)
+// IncrementRedirects counts a redirect of the ShortURL for the token in a single
+// statement, so it cannot overwrite a concurrent edit, and returns the new count.
+// Its events are given the token and the new count.
+func (s *GormStore) IncrementRedirects(ctx context.Context, token string, events Events) (int, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	query := fmt.Sprintf(`UPDATE %s SET redirects = redirects + 1
+		WHERE token = $1 AND deleted_at IS NULL RETURNING redirects`, table)
+	tx, err := s.client.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	redirects := 0
+	err = tx.QueryRowContext(ctx, query, token).Scan(&redirects)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := s.queueEvents(ctx, tx, events, []ShortURL{{Token: token, Redirects: redirects}}); err != nil {
+		return 0, err
+	}
+	return redirects, tx.Commit()
+}
+
+// UpdateLink applies the set fields of update to the ShortURL for the token,
+// including fields being cleared, and returns the updated ShortURL
+func (s *GormStore) UpdateLink(ctx context.Context, token string, update *LinkUpdate, events Events) (*ShortURL, error) {
+	columns := map[string]interface{}{}
+	if update.UTM != nil {
+		columns["utm_source"] = update.UTM.Source
+		columns["utm_medium"] = update.UTM.Medium
+		columns["utm_campaign"] = update.UTM.Campaign
+		columns["utm_term"] = update.UTM.Term
+		columns["utm_content"] = update.UTM.Content
+	}
+	if update.Rules != nil {
+		columns["rules"] = *update.Rules
+	}
+	if update.Variants != nil {
+		columns["variants"] = *update.Variants
+	}
+	if update.Interstitial != nil {
+		columns["interstitial"] = *update.Interstitial
+	}
+	if update.FallbackURL != nil {
+		columns["fallback_url"] = *update.FallbackURL
+	}
+	if update.Folder != nil {
+		columns["folder"] = *update.Folder
+	}
+	tx := s.client.Begin()
+	defer tx.Rollback()
+	count := 0
+	if err := tx.Model(&ShortURL{}).Where("token = ?", token).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrNotFound
+	}
+	if len(columns) > 0 {
+		if err := tx.Model(&ShortURL{}).Where("token = ?", token).Updates(columns).Error; err != nil {
+			return nil, err
+		}
+	}
+	if update.Tags != nil {
+		if err := s.setTags(tx, token, *update.Tags); err != nil {
+			return nil, err
+		}
+	}
+	shortURL, err := s.getShortURL(ctx, tx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.queueEvents(ctx, runnerOf(tx), events, []ShortURL{*shortURL}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return shortURL, nil
+}
+
+// SetStatus changes the status of the ShortURL for the token and returns the updated ShortURL
+func (s *GormStore) SetStatus(ctx context.Context, token string, change *StatusChange, events Events) (*ShortURL, error) {
+	tx := s.client.Begin()
+	defer tx.Rollback()
+	result := tx.Model(&ShortURL{}).Where("token = ?", token).Updates(map[string]interface{}{
+		"status":            change.Status,
+		"status_reason":     change.Reason,
+		"status_actor":      change.Actor,
+		"status_changed_at": change.At,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	shortURL, err := s.getShortURL(ctx, tx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.queueEvents(ctx, runnerOf(tx), events, []ShortURL{*shortURL}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return shortURL, nil
+}
+
+// DeleteShortURL moves the given ShortURL to the trash in Postgres. Trashed
+// ShortURLs are hidden from every other query until restored or purged.
+func (s *GormStore) DeleteShortURL(ctx context.Context, token string, events Events) error {
+	tx := s.client.Begin()
+	defer tx.Rollback()
+	shortURL, err := s.getShortURL(ctx, tx, token)
 	if err != nil {
 		return err
 	}
-	if err := s.client.Delete(&shortURL).Error; err != nil {
+	if err := tx.Delete(shortURL).Error; err != nil {
+		return err
+	}
+	if err := s.queueEvents(ctx, runnerOf(tx), events, []ShortURL{*shortURL}); err != nil {
 		return err
 	}
+	return tx.Commit().Error
+}
+
+// TokenExists reports whether a ShortURL uses the token, including ShortURLs in the trash
+func (s *GormStore) TokenExists(ctx context.Context, token string) (bool, error) {
+	count := 0
+	if err := s.client.Unscoped().Model(&ShortURL{}).Where("token = ?", token).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListDeleted lists the ShortURLs in the trash, most recently deleted first
+func (s *GormStore) ListDeleted(ctx context.Context, limit, offset int) (ShortURLS, error) {
+	var shortURLs ShortURLS
+	err := s.client.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&shortURLs).Error
+	return shortURLs, err
+}
+
+// RestoreShortURLs takes the ShortURLs for the tokens out of the trash and
+// returns the tokens that were restored. Its events are given the restored
+// ShortURLs in full.
+func (s *GormStore) RestoreShortURLs(ctx context.Context, tokens []string, events Events) ([]string, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	query := fmt.Sprintf(`UPDATE %s SET deleted_at = NULL
+		WHERE token = ANY($1) AND deleted_at IS NOT NULL RETURNING token`, table)
+	tx := s.client.Begin()
+	defer tx.Rollback()
+	rows, err := runnerOf(tx).QueryContext(ctx, query, pq.Array(tokens))
+	if err != nil {
+		return nil, err
+	}
+	restored, err := scanTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if events != nil && len(restored) > 0 {
+		shortURLs, err := s.shortURLsOf(ctx, tx, restored)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.queueEvents(ctx, runnerOf(tx), events, shortURLs); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeDeleted permanently deletes up to limit ShortURLs that were moved to the
+// trash before the given time, along with their tags and clicks, and returns
+// their tokens. Tags no other ShortURL has are deleted too.
+func (s *GormStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	query := fmt.Sprintf(`WITH purged AS (
+		DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE deleted_at < $1 LIMIT $2) RETURNING token
+	), untagged AS (
+		DELETE FROM %[2]s WHERE token IN (SELECT token FROM purged) RETURNING tag_id
+	), unclicked AS (
+		DELETE FROM %[3]s WHERE token IN (SELECT token FROM purged)
+	), pruned AS (
+		DELETE FROM %[4]s t WHERE t.id IN (SELECT tag_id FROM untagged) AND NOT EXISTS (
+			SELECT 1 FROM %[2]s lt WHERE lt.tag_id = t.id AND lt.token NOT IN (SELECT token FROM purged))
+	) SELECT token FROM purged`, table, s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&Clicks{}).TableName(),
+		s.client.NewScope(&Tag{}).TableName())
+	rows, err := s.client.DB().QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanTokens(rows)
+}
+
+// DeleteExpired deletes up to limit ShortURLs that expired before the given time,
+// along with their tags and clicks, in a single statement and returns their
+// tokens. ShortURLs with a fallback URL are kept so they can keep redirecting to
+// it, and ShortURLs in the trash are left for PurgeDeleted. Tags no other
+// ShortURL has are deleted too.
+func (s *GormStore) DeleteExpired(ctx context.Context, before time.Time, limit int, events Events) ([]string, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	query := fmt.Sprintf(`WITH expired AS (
+		DELETE FROM %[1]s WHERE id IN (
+			SELECT id FROM %[1]s WHERE NULLIF(expiration, '')::timestamptz < $1
+				AND COALESCE(fallback_url, '') = '' AND deleted_at IS NULL LIMIT $2
+		) RETURNING token
+	), untagged AS (
+		DELETE FROM %[2]s WHERE token IN (SELECT token FROM expired) RETURNING tag_id
+	), unclicked AS (
+		DELETE FROM %[3]s WHERE token IN (SELECT token FROM expired)
+	), tombstoned AS (
+		INSERT INTO %[4]s (token, expired_at) SELECT token, $1 FROM expired
+			ON CONFLICT (token) DO UPDATE SET expired_at = EXCLUDED.expired_at
+	), pruned AS (
+		DELETE FROM %[5]s t WHERE t.id IN (SELECT tag_id FROM untagged) AND NOT EXISTS (
+			SELECT 1 FROM %[2]s lt WHERE lt.tag_id = t.id AND lt.token NOT IN (SELECT token FROM expired))
+	) SELECT token FROM expired`, table, s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&Clicks{}).TableName(),
+		s.client.NewScope(&Tombstone{}).TableName(), s.client.NewScope(&Tag{}).TableName())
+	tx, err := s.client.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.queueEvents(ctx, tx, events, tokenLinks(tokens)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TokenExpired reports whether the sweeper deleted a ShortURL with the token
+// after it expired
+func (s *GormStore) TokenExpired(ctx context.Context, token string) (bool, error) {
+	count := 0
+	if err := s.client.Model(&Tombstone{}).Where("token = ?", token).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PurgeTombstones removes the tombstones of ShortURLs that expired before the
+// given time
+func (s *GormStore) PurgeTombstones(ctx context.Context, before time.Time) (int, error) {
+	result := s.client.Where("expired_at < ?", before).Delete(&Tombstone{})
+	return int(result.RowsAffected), result.Error
+}
+
+// tokenLinks returns ShortURLs with only the tokens set, for the events of
+// mutations that return tokens
+func tokenLinks(tokens []string) []ShortURL {
+	shortURLs := make([]ShortURL, len(tokens))
+	for i, token := range tokens {
+		shortURLs[i].Token = token
+	}
+	return shortURLs
+}
+
+// scanTokens reads the tokens returned by a query and closes the rows
+func scanTokens(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// MatchLinks counts the ShortURLs matching the filter, digests their tokens and
+// returns up to sample of them
+func (s *GormStore) MatchLinks(ctx context.Context, filter *LinkFilter, sample int) (*LinkMatch, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	where, args := s.filterClause(filter)
+	match := LinkMatch{}
+	query := fmt.Sprintf(`SELECT COUNT(*), encode(sha256(convert_to(
+		COALESCE(string_agg(token, ',' ORDER BY token COLLATE "C"), ''), 'UTF8')), 'hex') FROM %s WHERE %s`, table, where)
+	if err := s.client.DB().QueryRowContext(ctx, query, args...).Scan(&match.Count, &match.Digest); err != nil {
+		return nil, err
+	}
+	query = fmt.Sprintf(`SELECT token FROM %s WHERE %s ORDER BY id LIMIT $%d`, table, where, len(args)+1)
+	rows, err := s.client.DB().QueryContext(ctx, query, append(args, sample)...)
+	if err != nil {
+		return nil, err
+	}
+	match.Sample, err = scanTokens(rows)
+	return &match, err
+}
+
+// DeleteLinks moves the ShortURLs matching the filter to the trash in a single
+// transaction and returns their tokens. Nothing is deleted, and ErrMatchChanged
+// is returned, unless the matched tokens have the digest MatchLinks returned.
+func (s *GormStore) DeleteLinks(ctx context.Context, filter *LinkFilter, digest string, events Events) ([]string, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	where, args := s.filterClause(filter)
+	query := fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE %s RETURNING token`, table, where)
+	tx, err := s.client.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if tokenDigest(tokens) != digest {
+		return nil, ErrMatchChanged
+	}
+	if err := s.queueEvents(ctx, tx, events, tokenLinks(tokens)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// tokenDigest digests a set of tokens the same way MatchLinks does in SQL: the
+// hex SHA-256 of the tokens in byte order, joined by commas
+func tokenDigest(tokens []string) string {
+	sorted := append([]string(nil), tokens...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// filterClause builds the WHERE clause and arguments selecting the ShortURLs
+// outside the trash that match the filter
+func (s *GormStore) filterClause(filter *LinkFilter) (string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), -1))
+	}
+	if filter.Owner != "" {
+		add("owner = ?", filter.Owner)
+	}
+	if filter.Tag != "" {
+		add(fmt.Sprintf("token IN (SELECT lt.token FROM %s lt JOIN %s t ON t.id = lt.tag_id WHERE t.name = ?)",
+			s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&Tag{}).TableName()), filter.Tag)
+	}
+	if filter.Folder != "" {
+		add("folder = ?", filter.Folder)
+	}
+	if filter.Domain != "" {
+		args = append(args, strings.ToLower(filter.Domain))
+		host := `LOWER(SUBSTRING(url FROM '^[^:]+://([^/:?#]+)'))`
+		conditions = append(conditions, fmt.Sprintf("(%[1]s = $%[2]d OR %[1]s LIKE '%%.' || $%[2]d)", host, len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.ExpiresAfter != nil {
+		add("NULLIF(expiration, '')::timestamptz >= ?", *filter.ExpiresAfter)
+	}
+	if filter.ExpiresBefore != nil {
+		add("NULLIF(expiration, '')::timestamptz < ?", *filter.ExpiresBefore)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// RecordAudit appends the entry to the audit log
+func (s *GormStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	return s.client.Create(entry).Error
+}
+
+// ListAudit lists the audit entries matching the filter, newest first
+func (s *GormStore) ListAudit(ctx context.Context, filter *AuditFilter) ([]AuditEntry, error) {
+	query := s.client.Order("id DESC")
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Token != "" {
+		query = query.Where("token = ?", filter.Token)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	entries := []AuditEntry{}
+	err := query.Find(&entries).Error
+	return entries, err
+}
+
+// ListInterstitialDomains lists the domains that get the interstitial warning page
+func (s *GormStore) ListInterstitialDomains(ctx context.Context) ([]InterstitialDomain, error) {
+	domains := []InterstitialDomain{}
+	err := s.client.Order("domain").Find(&domains).Error
+	return domains, err
+}
+
+// AddInterstitialDomain turns the interstitial warning page on for a domain, adding
+// a domain that is already on does nothing
+func (s *GormStore) AddInterstitialDomain(ctx context.Context, domain *InterstitialDomain) error {
+	table := s.client.NewScope(&InterstitialDomain{}).TableName()
+	return s.client.Exec(fmt.Sprintf(`INSERT INTO %s (domain, created_at) VALUES (?, NOW()) ON CONFLICT (domain) DO NOTHING`, table),
+		domain.Domain).Error
+}
+
+// DeleteInterstitialDomain turns the interstitial warning page off for a domain,
+// or returns ErrNotFound
+func (s *GormStore) DeleteInterstitialDomain(ctx context.Context, domain string) error {
+	result := s.client.Where("domain = ?", domain).Delete(&InterstitialDomain{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
-// CollectStats collects the overall stats of the service
-func (s *GormStore) CollectStats() (*Stats, error) {
-	stats := Stats{}
-	if err := s.client.Model(&ShortURL{}).Count(&stats.TotalURLs).Error; err != nil {
+// CreateWebhook creates the given Webhook in Postgres
+func (s *GormStore) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	return s.client.Create(webhook).Error
+}
+
+// GetWebhook gets the Webhook with the given id, or ErrNotFound
+func (s *GormStore) GetWebhook(ctx context.Context, id uint) (*Webhook, error) {
+	webhook := Webhook{}
+	err := s.client.Where("id = ?", id).First(&webhook).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks lists every Webhook
+func (s *GormStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := s.client.Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteWebhook deletes the Webhook with the given id, its delivery log is kept
+func (s *GormStore) DeleteWebhook(ctx context.Context, id uint) error {
+	result := s.client.Where("id = ?", id).Delete(&Webhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// queueEvents builds the events of a mutation from the ShortURLs it changed and
+// queues them with tx, the transaction making the change
+func (s *GormStore) queueEvents(ctx context.Context, tx sqlRunner, events Events, changed []ShortURL) error {
+	if events == nil {
+		return nil
+	}
+	queued, err := events(changed)
+	if err != nil {
+		return err
+	}
+	return s.enqueueEvents(ctx, tx, queued)
+}
+
+// enqueueEvents adds a pending delivery of each event for every webhook
+// subscribed to its type, in a single statement however many events there are
+func (s *GormStore) enqueueEvents(ctx context.Context, tx sqlRunner, events []*WebhookEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]string, len(events))
+	types := make([]string, len(events))
+	tokens := make([]string, len(events))
+	payloads := make([]string, len(events))
+	createdAt := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+		types[i] = event.Type
+		tokens[i] = event.Token
+		payloads[i] = string(event.Payload)
+		createdAt[i] = event.CreatedAt.Format(time.RFC3339Nano)
+	}
+	query := fmt.Sprintf(`INSERT INTO %s
+		(webhook_id, event_id, event, token, payload, status, attempts, next_attempt_at, created_at)
+		SELECT w.id, e.id, e.type, e.token, e.payload, $6, 0, e.created_at, e.created_at
+		FROM UNNEST($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[])
+			WITH ORDINALITY AS e (id, type, token, payload, created_at, n)
+		JOIN %s w ON w.deleted_at IS NULL AND (COALESCE(CARDINALITY(w.events), 0) = 0 OR e.type = ANY(w.events))
+		ORDER BY e.n, w.id`, s.client.NewScope(&WebhookDelivery{}).TableName(), s.client.NewScope(&Webhook{}).TableName())
+	_, err := tx.ExecContext(ctx, query, pq.Array(ids), pq.Array(types), pq.Array(tokens), pq.Array(payloads),
+		pq.Array(createdAt), DeliveryPending)
+	return err
+}
+
+// ClaimDeliveries claims up to limit pending deliveries whose next attempt is
+// due, oldest first, until the given time. Rows another process is claiming, or
+// has claimed and not released, are skipped, so no delivery is attempted twice.
+func (s *GormStore) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) ([]WebhookDelivery, error) {
+	table := s.client.NewScope(&WebhookDelivery{}).TableName()
+	query := fmt.Sprintf(`UPDATE %[1]s SET locked_until = ? WHERE id IN (
+		SELECT id FROM %[1]s WHERE status = ? AND next_attempt_at <= ?
+			AND (locked_until IS NULL OR locked_until <= ?)
+		ORDER BY next_attempt_at, id LIMIT ? FOR UPDATE SKIP LOCKED
+	) RETURNING *`, table)
+	deliveries := []WebhookDelivery{}
+	err := s.client.Raw(query, until, DeliveryPending, now, now, limit).Scan(&deliveries).Error
+	return deliveries, err
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt and releases its claim
+func (s *GormStore) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	delivery.LockedUntil = nil
+	return s.client.Save(delivery).Error
+}
+
+// ListDeliveries lists up to limit deliveries to the webhook, newest first
+func (s *GormStore) ListDeliveries(ctx context.Context, webhookID uint, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := s.client.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// CollectStats collects the overall stats of the ShortURLs matching the filter,
+// in total and for each of their tags
+func (s *GormStore) CollectStats(ctx context.Context, filter *LinkFilter) (*Stats, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	where, args := s.filterClause(filter)
+	stats := Stats{Tags: map[string]TagStats{}}
+	row := s.client.DB().QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT COUNT(*), COALESCE(SUM(redirects), 0) FROM %s WHERE %s`, table, where), args...)
+	if err := row.Scan(&stats.TotalURLs, &stats.TotalRedirects); err != nil {
 		return &stats, err
 	}
-	allURLs := ShortURLS{}
-	if err := s.client.Find(&allURLs).Error; err != nil {
+	query := fmt.Sprintf(`SELECT t.name, COUNT(*), COALESCE(SUM(s.redirects), 0)
+		FROM (SELECT token, redirects FROM %s WHERE %s) s
+		JOIN %s lt ON lt.token = s.token JOIN %s t ON t.id = lt.tag_id
+		GROUP BY t.name`, table, where, s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&Tag{}).TableName())
+	rows, err := s.client.DB().QueryContext(ctx, query, args...)
+	if err != nil {
 		return &stats, err
 	}
-	stats.TotalRedirects = 0
-	for _, url := range allURLs {
-		stats.TotalRedirects += url.Redirects
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var tag TagStats
+		if err := rows.Scan(&name, &tag.URLs, &tag.Redirects); err != nil {
+			return &stats, err
+		}
+		stats.Tags[name] = tag
+	}
+	return &stats, rows.Err()
+}
+
+// ListLinks lists the ShortURLs matching the filter with their tags, oldest first
+func (s *GormStore) ListLinks(ctx context.Context, filter *LinkFilter, limit, offset int) (ShortURLS, error) {
+	table := s.client.NewScope(&ShortURL{}).TableName()
+	where, args := s.filterClause(filter)
+	query := fmt.Sprintf(`SELECT token FROM %s WHERE %s ORDER BY id LIMIT $%d OFFSET $%d`, table, where, len(args)+1, len(args)+2)
+	rows, err := s.client.DB().QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	return s.shortURLsOf(ctx, s.client, tokens)
+}
+
+// shortURLsOf gets the ShortURLs for the tokens with their tags, oldest first,
+// with db, which may be a transaction
+func (s *GormStore) shortURLsOf(ctx context.Context, db *gorm.DB, tokens []string) (ShortURLS, error) {
+	shortURLs := ShortURLS{}
+	if len(tokens) == 0 {
+		return shortURLs, nil
+	}
+	if err := db.Where("token IN (?)", tokens).Order("id").Find(&shortURLs).Error; err != nil {
+		return nil, err
+	}
+	tags, err := s.tagsOf(ctx, runnerOf(db), tokens)
+	if err != nil {
+		return nil, err
+	}
+	for i := range shortURLs {
+		shortURLs[i].Tags = tags[shortURLs[i].Token]
+	}
+	return shortURLs, nil
+}
+
+// ListTags lists every tag with how many ShortURLs have it
+func (s *GormStore) ListTags(ctx context.Context) ([]TagCount, error) {
+	query := fmt.Sprintf(`SELECT t.name, COUNT(s.id) FROM %s t
+		LEFT JOIN %s lt ON lt.tag_id = t.id
+		LEFT JOIN %s s ON s.token = lt.token AND s.deleted_at IS NULL
+		GROUP BY t.name ORDER BY t.name`,
+		s.client.NewScope(&Tag{}).TableName(), s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&ShortURL{}).TableName())
+	rows, err := s.client.DB().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.URLs); err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag renames a tag on every ShortURL that has it, or returns ErrNotFound
+// or ErrTagExists
+func (s *GormStore) RenameTag(ctx context.Context, from, to string) error {
+	result := s.client.Model(&Tag{}).Where("name = ?", from).Update("name", to)
+	if pqErr, ok := result.Error.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		return ErrTagExists
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteTag removes a tag from every ShortURL that has it, or returns ErrNotFound
+func (s *GormStore) DeleteTag(ctx context.Context, name string) error {
+	tag := Tag{}
+	err := s.client.Where("name = ?", name).First(&tag).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	tx := s.client.Begin()
+	if err := tx.Where("tag_id = ?", tag.ID).Delete(&LinkTag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&tag).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ListFolders lists every folder with how many ShortURLs are in it
+func (s *GormStore) ListFolders(ctx context.Context) ([]FolderCount, error) {
+	query := fmt.Sprintf(`SELECT folder, COUNT(*) FROM %s
+		WHERE deleted_at IS NULL AND COALESCE(folder, '') <> ''
+		GROUP BY folder ORDER BY folder`, s.client.NewScope(&ShortURL{}).TableName())
+	rows, err := s.client.DB().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	folders := []FolderCount{}
+	for rows.Next() {
+		var folder FolderCount
+		if err := rows.Scan(&folder.Name, &folder.URLs); err != nil {
+			return folders, err
+		}
+		folders = append(folders, folder)
 	}
-	return &stats, nil
+	return folders, rows.Err()
+}
+
+// setTags replaces the tags of the ShortURL for the token, creating tags that
+// do not exist yet
+func (s *GormStore) setTags(tx *gorm.DB, token string, tags []string) error {
+	tagTable := s.client.NewScope(&Tag{}).TableName()
+	linkTagTable := s.client.NewScope(&LinkTag{}).TableName()
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE token = ?`, linkTagTable), token).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	if err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (name) SELECT UNNEST(?::text[]) ON CONFLICT (name) DO NOTHING`, tagTable),
+		pq.Array(tags)).Error; err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf(`INSERT INTO %s (token, tag_id) SELECT ?, id FROM %s WHERE name = ANY(?::text[])`, linkTagTable, tagTable),
+		token, pq.Array(tags)).Error
+}
+
+// tagsOf gets the tags of the ShortURLs for the tokens, sorted by name
+func (s *GormStore) tagsOf(ctx context.Context, db sqlRunner, tokens []string) (map[string][]string, error) {
+	query := fmt.Sprintf(`SELECT lt.token, t.name FROM %s lt JOIN %s t ON t.id = lt.tag_id
+		WHERE lt.token = ANY($1) ORDER BY t.name`, s.client.NewScope(&LinkTag{}).TableName(), s.client.NewScope(&Tag{}).TableName())
+	rows, err := db.QueryContext(ctx, query, pq.Array(tokens))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := map[string][]string{}
+	for rows.Next() {
+		var token, name string
+		if err := rows.Scan(&token, &name); err != nil {
+			return tags, err
+		}
+		tags[token] = append(tags[token], name)
+	}
+	return tags, rows.Err()
+}
+
+// IncrementClicks counts a redirect of the token under a value of a dimension
+func (s *GormStore) IncrementClicks(ctx context.Context, token, dimension, value string) error {
+	table := s.client.NewScope(&Clicks{}).TableName()
+	query := fmt.Sprintf(`INSERT INTO %[1]s (token, dimension, value, count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (token, dimension, value) DO UPDATE SET count = %[1]s.count + 1`, table)
+	_, err := s.client.DB().ExecContext(ctx, query, token, dimension, value)
+	return err
+}
+
+// GetClicks gets the redirects of the token by dimension and value
+func (s *GormStore) GetClicks(ctx context.Context, token string) (map[string]map[string]int, error) {
+	var rows []Clicks
+	if err := s.client.Where("token = ?", token).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	clicks := map[string]map[string]int{}
+	for _, row := range rows {
+		if clicks[row.Dimension] == nil {
+			clicks[row.Dimension] = map[string]int{}
+		}
+		clicks[row.Dimension][row.Value] = row.Count
+	}
+	return clicks, nil
+}
+
+// CountActiveLinks counts the owner's ShortURLs that have not expired
+func (s *GormStore) CountActiveLinks(ctx context.Context, owner string, now time.Time) (int, error) {
+	count := 0
+	err := s.client.Model(&ShortURL{}).
+		Where("owner = ? AND NULLIF(expiration, '')::timestamptz > ?", owner, now).
+		Count(&count).Error
+	return count, err
+}
+
+// GetCreations gets how many ShortURLs the owner created in the period
+func (s *GormStore) GetCreations(ctx context.Context, owner string, periodStart time.Time) (int, error) {
+	usage := Usage{}
+	err := s.client.Where("owner = ? AND period_start = ?", owner, periodStart).First(&usage).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, nil
+	}
+	return usage.Creations, err
+}
+
+// claimQuota counts a creation for the claim's owner unless it would pass
+// MaxCreations, then checks owner's active links. The upsert locks the usage
+// row until the transaction ends, so concurrent creations are checked in turn.
+func (s *GormStore) claimQuota(tx *gorm.DB, owner string, claim *QuotaClaim) error {
+	table := s.client.NewScope(&Usage{}).TableName()
+	query := fmt.Sprintf(`INSERT INTO %[1]s (owner, period_start, creations) VALUES (?, ?, 1)
+		ON CONFLICT (owner, period_start) DO UPDATE SET creations = %[1]s.creations + 1
+		WHERE ? <= 0 OR %[1]s.creations < ? RETURNING creations`, table)
+	creations := 0
+	err := tx.Raw(query, claim.Owner, claim.PeriodStart, claim.MaxCreations, claim.MaxCreations).Row().Scan(&creations)
+	if err == sql.ErrNoRows {
+		return ErrCreationQuota
+	}
+	if err != nil {
+		return err
+	}
+	if claim.MaxActiveLinks <= 0 {
+		return nil
+	}
+	active := 0
+	err = tx.Model(&ShortURL{}).
+		Where("owner = ? AND NULLIF(expiration, '')::timestamptz > ?", owner, claim.Now).
+		Count(&active).Error
+	if err != nil {
+		return err
+	}
+	if active >= claim.MaxActiveLinks {
+		return ErrActiveLinkQuota
+	}
+	return nil
+}
+
+// Ping checks that Postgres is reachable
+func (s *GormStore) Ping(ctx context.Context) error {
+	return s.client.DB().PingContext(ctx)
+}
+
+// Close closes the connection to Postgres
+func (s *GormStore) Close() error {
+	return s.client.Close()
 }
@@ -1,31 +1,393 @@
 package db
 
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/targeting"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrNotFound is returned when no ShortURL exists for a token
+	ErrNotFound = errors.New("short url not found")
+	// ErrTagExists is returned when renaming a tag to the name of another tag
+	ErrTagExists = errors.New("tag already exists")
+	// ErrMatchChanged is returned when a bulk operation matches different
+	// ShortURLs than the caller expected
+	ErrMatchChanged = errors.New("matched short urls changed")
+	// ErrCreationQuota is returned when creating a ShortURL would exceed the
+	// owner's creations for the period
+	ErrCreationQuota = errors.New("creation quota exceeded")
+	// ErrActiveLinkQuota is returned when creating a ShortURL would exceed the
+	// owner's active ShortURLs
+	ErrActiveLinkQuota = errors.New("active link quota exceeded")
+)
+
 // Store represents a generic database store for URL shorteners
 type Store interface {
 	InitDB(user, pass, name, host string, port int) error
-	GetShortURL(token string) (*ShortURL, error)
-	GetAllURLTokens() ([]string, error)
-	CreateShortURL(shortURL *ShortURL) error
-	UpdateShortURL(shortURL *ShortURL) error
-	DeleteShortURL(token string) error
-	CollectStats() (*Stats, error)
+	GetShortURL(ctx context.Context, token string) (*ShortURL, error)
+	GetAllURLTokens(ctx context.Context) ([]string, error)
+	CreateShortURL(ctx context.Context, shortURL *ShortURL, claim *QuotaClaim, events Events) error
+	UpdateShortURL(ctx context.Context, shortURL *ShortURL) error
+	IncrementRedirects(ctx context.Context, token string, events Events) (int, error)
+	UpdateLink(ctx context.Context, token string, update *LinkUpdate, events Events) (*ShortURL, error)
+	SetStatus(ctx context.Context, token string, change *StatusChange, events Events) (*ShortURL, error)
+	DeleteShortURL(ctx context.Context, token string, events Events) error
+	TokenExists(ctx context.Context, token string) (bool, error)
+	ListDeleted(ctx context.Context, limit, offset int) (ShortURLS, error)
+	RestoreShortURLs(ctx context.Context, tokens []string, events Events) ([]string, error)
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]string, error)
+	MatchLinks(ctx context.Context, filter *LinkFilter, sample int) (*LinkMatch, error)
+	DeleteLinks(ctx context.Context, filter *LinkFilter, digest string, events Events) ([]string, error)
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	ListAudit(ctx context.Context, filter *AuditFilter) ([]AuditEntry, error)
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, id uint) (*Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id uint) error
+	ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	ListDeliveries(ctx context.Context, webhookID uint, limit int) ([]WebhookDelivery, error)
+	DeleteExpired(ctx context.Context, before time.Time, limit int, events Events) ([]string, error)
+	TokenExpired(ctx context.Context, token string) (bool, error)
+	PurgeTombstones(ctx context.Context, before time.Time) (int, error)
+	CollectStats(ctx context.Context, filter *LinkFilter) (*Stats, error)
+	ListLinks(ctx context.Context, filter *LinkFilter, limit, offset int) (ShortURLS, error)
+	ListTags(ctx context.Context) ([]TagCount, error)
+	RenameTag(ctx context.Context, from, to string) error
+	DeleteTag(ctx context.Context, name string) error
+	ListFolders(ctx context.Context) ([]FolderCount, error)
+	ListInterstitialDomains(ctx context.Context) ([]InterstitialDomain, error)
+	AddInterstitialDomain(ctx context.Context, domain *InterstitialDomain) error
+	DeleteInterstitialDomain(ctx context.Context, domain string) error
+	IncrementClicks(ctx context.Context, token, dimension, value string) error
+	GetClicks(ctx context.Context, token string) (map[string]map[string]int, error)
+	CountActiveLinks(ctx context.Context, owner string, now time.Time) (int, error)
+	GetCreations(ctx context.Context, owner string, periodStart time.Time) (int, error)
+	Ping(ctx context.Context) error
+	Close() error
 }
 
 // Stats holds the overall stats for the service
 type Stats struct {
-	TotalURLs      int `json:"total_urls"`
-	TotalRedirects int `json:"total_redirects"`
+	TotalURLs      int                 `json:"total_urls"`
+	TotalRedirects int                 `json:"total_redirects"`
+	Tags           map[string]TagStats `json:"tags"`
+}
+
+// TagStats holds the stats of the ShortURLs with a tag
+type TagStats struct {
+	URLs      int `json:"urls"`
+	Redirects int `json:"redirects"`
 }
 
 // ShortURL represents the shortened url and all related metadata
 type ShortURL struct {
-	ID           uint   `json:"-"`
-	URL          string `json:"url"`
-	Token        string `json:"token"`
-	ShortenedURL string `json:"shortened_url"`
-	Expiration   string `json:"expiration"`
-	Redirects    int    `json:"redirects"`
+	ID              uint               `json:"-"`
+	URL             string             `json:"url"`
+	Token           string             `json:"token"`
+	ShortenedURL    string             `json:"shortened_url"`
+	Expiration      string             `json:"expiration"`
+	Activation      string             `json:"activation,omitempty"`
+	FallbackURL     string             `json:"fallback_url,omitempty"`
+	Redirects       int                `json:"redirects"`
+	RedirectType    int                `json:"redirect_type"`
+	Passthrough     bool               `json:"passthrough"`
+	QueryPrecedence string             `json:"query_precedence,omitempty"`
+	UTM             UTM                `json:"utm" gorm:"embedded;embedded_prefix:utm_"`
+	Rules           targeting.Rules    `json:"rules,omitempty" gorm:"type:text"`
+	Variants        targeting.Variants `json:"variants,omitempty" gorm:"type:text"`
+	Interstitial    bool               `json:"interstitial"`
+	Status          string             `json:"status"`
+	StatusReason    string             `json:"status_reason,omitempty"`
+	StatusActor     string             `json:"status_actor,omitempty"`
+	StatusChangedAt *time.Time         `json:"status_changed_at,omitempty"`
+	Owner           string             `json:"owner,omitempty" gorm:"index"`
+	Folder          string             `json:"folder,omitempty" gorm:"index"`
+	Tags            []string           `json:"tags,omitempty" gorm:"-"`
+	CreatedAt       time.Time          `json:"created_at"`
+	DeletedAt       *time.Time         `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// UTM holds the campaign parameters added to the destination at redirect time
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Params returns the UTM query parameters that are set
+func (u UTM) Params() map[string]string {
+	params := map[string]string{}
+	for key, value := range map[string]string{
+		"utm_source":   u.Source,
+		"utm_medium":   u.Medium,
+		"utm_campaign": u.Campaign,
+		"utm_term":     u.Term,
+		"utm_content":  u.Content,
+	} {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+// LinkUpdate holds the editable fields of a ShortURL, nil fields are left unchanged
+type LinkUpdate struct {
+	UTM          *UTM                `json:"utm"`
+	Rules        *targeting.Rules    `json:"rules"`
+	Variants     *targeting.Variants `json:"variants"`
+	Interstitial *bool               `json:"interstitial"`
+	FallbackURL  *string             `json:"fallback_url"`
+	Folder       *string             `json:"folder"`
+	Tags         *[]string           `json:"tags"`
+}
+
+// Link statuses, a ShortURL only redirects while it is active
+const (
+	StatusActive    = "active"
+	StatusDisabled  = "disabled"
+	StatusSuspended = "suspended"
+)
+
+// ValidStatus reports whether status is a known link status
+func ValidStatus(status string) bool {
+	return status == StatusActive || status == StatusDisabled || status == StatusSuspended
+}
+
+// Enabled reports whether the ShortURL redirects. ShortURLs created before
+// statuses existed have none and are active.
+func (s *ShortURL) Enabled() bool {
+	return s.Status == "" || s.Status == StatusActive
+}
+
+// StatusChange records who changed the status of a ShortURL, when and why
+type StatusChange struct {
+	Status string
+	Reason string
+	Actor  string
+	At     time.Time
+}
+
+// LinkFilter selects ShortURLs for bulk operations, unset fields match every ShortURL
+type LinkFilter struct {
+	Owner  string `json:"owner,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Folder string `json:"folder,omitempty"`
+	// Domain matches the host of the destination URL and its subdomains
+	Domain        string     `json:"domain,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	ExpiresAfter  *time.Time `json:"expires_after,omitempty"`
+	ExpiresBefore *time.Time `json:"expires_before,omitempty"`
+}
+
+// LinkMatch describes the ShortURLs a filter matched. Digest identifies the
+// exact set of matched tokens, it changes when any ShortURL joins or leaves it.
+type LinkMatch struct {
+	Count  int
+	Sample []string
+	Digest string
 }
 
 // ShortURLS represents multiple ShortURL
 type ShortURLS []ShortURL
+
+// Click dimensions break down the redirects of a ShortURL
+const (
+	DimensionCountry = "country"
+	DimensionVariant = "variant"
+)
+
+// Clicks counts the redirects of a ShortURL for one value of a dimension
+type Clicks struct {
+	Token     string `gorm:"primary_key"`
+	Dimension string `gorm:"primary_key"`
+	Value     string `gorm:"primary_key"`
+	Count     int
+}
+
+// Tag labels ShortURLs, a ShortURL can have many tags and a tag many ShortURLs
+type Tag struct {
+	ID   uint   `json:"-"`
+	Name string `json:"name" gorm:"unique_index;not null"`
+}
+
+// LinkTag links a ShortURL to one of its tags
+type LinkTag struct {
+	Token string `gorm:"primary_key"`
+	TagID uint   `gorm:"primary_key;auto_increment:false"`
+}
+
+// TagCount holds a tag and how many ShortURLs have it
+type TagCount struct {
+	Name string `json:"name"`
+	URLs int    `json:"urls"`
+}
+
+// FolderCount holds a folder and how many ShortURLs are in it
+type FolderCount struct {
+	Name string `json:"name"`
+	URLs int    `json:"urls"`
+}
+
+// Usage counts the ShortURLs an owner created in a quota period
+type Usage struct {
+	Owner       string    `gorm:"primary_key"`
+	PeriodStart time.Time `gorm:"primary_key"`
+	Creations   int
+}
+
+// QuotaClaim is what creating a ShortURL counts against a quota: a creation in
+// the Owner's Usage for the period, and a check of the ShortURL owner's active
+// links. A zero limit is unlimited.
+type QuotaClaim struct {
+	Owner          string
+	PeriodStart    time.Time
+	MaxCreations   int
+	MaxActiveLinks int
+	Now            time.Time
+}
+
+// AuditEntry records an administrative or mutating action. Entries are only
+// ever appended.
+type AuditEntry struct {
+	ID        uint      `json:"id"`
+	Action    string    `json:"action" gorm:"index"`
+	Token     string    `json:"token,omitempty" gorm:"index"`
+	Actor     string    `json:"actor" gorm:"index"`
+	IP        string    `json:"ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Before    Snapshot  `json:"before,omitempty" gorm:"type:text"`
+	After     Snapshot  `json:"after,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// AuditFilter selects audit entries, unset fields match every entry
+type AuditFilter struct {
+	Action string
+	Token  string
+	Actor  string
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+}
+
+// Snapshot holds the JSON encoded state of a record before or after an action
+type Snapshot []byte
+
+// MarshalJSON embeds the snapshot as JSON
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+// UnmarshalJSON keeps a copy of the JSON
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	*s = append((*s)[:0], data...)
+	return nil
+}
+
+// Value stores the snapshot as text
+func (s Snapshot) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+// Scan reads a snapshot stored as text
+func (s *Snapshot) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*s = nil
+	case string:
+		*s = Snapshot(src)
+	case []byte:
+		*s = append(Snapshot(nil), src...)
+	default:
+		return fmt.Errorf("cannot scan %T into Snapshot", src)
+	}
+	return nil
+}
+
+// Tombstone records the token of a ShortURL the sweeper deleted once it
+// expired, so a lookup can still tell it expired rather than never existed
+type Tombstone struct {
+	Token     string    `gorm:"primary_key"`
+	ExpiredAt time.Time `gorm:"index"`
+}
+
+// InterstitialDomain is a domain, with its subdomains, whose destinations always
+// get the interstitial warning page
+type InterstitialDomain struct {
+	Domain    string    `json:"domain" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webhook is a subscription to link lifecycle events. A webhook without events
+// receives every event.
+type Webhook struct {
+	ID        uint           `json:"id"`
+	URL       string         `json:"url"`
+	Secret    string         `json:"secret,omitempty"`
+	Events    pq.StringArray `json:"events" gorm:"type:text[]"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt *time.Time     `json:"-" gorm:"index"`
+}
+
+// WebhookEvent is an event to be delivered to every webhook subscribed to its type
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	Token     string
+	Payload   Snapshot
+	CreatedAt time.Time
+}
+
+// Events builds the webhook events of a mutation from the ShortURLs it changed.
+// Mutations queue the events in the transaction that makes the change, so they
+// are queued if and only if the change is committed. Mutations that change
+// ShortURLs in bulk, or delete them for good, only set their tokens.
+type Events func(changed []ShortURL) ([]*WebhookEvent, error)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event waiting for, or the outcome of, delivery to a webhook.
+// Pending deliveries form the outbox, the rest the delivery log.
+type WebhookDelivery struct {
+	ID             uint       `json:"id"`
+	WebhookID      uint       `json:"webhook_id" gorm:"index"`
+	EventID        string     `json:"event_id"`
+	Event          string     `json:"event"`
+	Token          string     `json:"token,omitempty"`
+	Payload        Snapshot   `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"index"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// LockedUntil is when the claim of the process attempting the delivery lapses
+	LockedUntil *time.Time `json:"-" gorm:"index"`
+}
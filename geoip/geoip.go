@@ -0,0 +1,136 @@
+package geoip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnavailable is returned when there is no usable database to resolve an IP from
+var ErrUnavailable = errors.New("geoip database unavailable")
+
+// Location is where an IP address is registered
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 country code
+	Country string
+	// Region is the ISO 3166-2 code of the first subdivision, such as US-CA
+	Region string
+}
+
+// Locator resolves the location of an IP address
+type Locator interface {
+	Locate(ip net.IP) (Location, error)
+}
+
+// Database is a Locator backed by a MaxMind-format database file that is
+// reloaded when the file changes. A missing or stale file makes every lookup
+// fail with ErrUnavailable so callers fall back to their defaults.
+type Database struct {
+	Path string
+	// MaxAge is how long after its build a database is trusted, zero trusts it forever
+	MaxAge time.Duration
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	now     func() time.Time
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// NewDatabase creates a Database for the file at path, call Reload to load it
+func NewDatabase(path string, maxAge time.Duration) *Database {
+	return &Database{Path: path, MaxAge: maxAge, now: time.Now}
+}
+
+// Reload opens the database file if it changed since it was last loaded. If the
+// file is gone the loaded database is dropped.
+func (d *Database) Reload() error {
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		d.swap(nil, time.Time{})
+		return err
+	}
+	d.mu.RLock()
+	unchanged := d.reader != nil && info.ModTime().Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	reader, err := maxminddb.Open(d.Path)
+	if err != nil {
+		return err
+	}
+	d.swap(reader, info.ModTime())
+	return nil
+}
+
+func (d *Database) swap(reader *maxminddb.Reader, modTime time.Time) {
+	d.mu.Lock()
+	old := d.reader
+	d.reader = reader
+	d.modTime = modTime
+	d.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// Watch reloads the database every interval until the context is cancelled
+func (d *Database) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Reload(); err != nil {
+				log.WithField("path", d.Path).WithError(err).Warn("Unable to reload GeoIP database")
+			}
+		}
+	}
+}
+
+// Locate resolves the location of ip
+func (d *Database) Locate(ip net.IP) (Location, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.reader == nil {
+		return Location{}, ErrUnavailable
+	}
+	if d.MaxAge > 0 {
+		built := time.Unix(int64(d.reader.Metadata.BuildEpoch), 0)
+		if d.now().Sub(built) > d.MaxAge {
+			return Location{}, ErrUnavailable
+		}
+	}
+	var result record
+	if err := d.reader.Lookup(ip, &result); err != nil {
+		return Location{}, err
+	}
+	location := Location{Country: result.Country.ISOCode}
+	if location.Country != "" && len(result.Subdivisions) > 0 && result.Subdivisions[0].ISOCode != "" {
+		location.Region = location.Country + "-" + result.Subdivisions[0].ISOCode
+	}
+	return location, nil
+}
+
+// Close releases the loaded database
+func (d *Database) Close() error {
+	d.swap(nil, time.Time{})
+	return nil
+}
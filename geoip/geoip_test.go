@@ -0,0 +1,176 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var buildTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// writeDatabase writes a minimal IPv4 MaxMind database mapping each network to a country and subdivision
+func writeDatabase(t *testing.T, path string, networks map[string][2]string) {
+	const empty, dataBit = -1, 1 << 30
+	nodes := [][2]int{{empty, empty}}
+	var data bytes.Buffer
+	for cidr, location := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		assert.NoError(t, err)
+		entry := map[string]interface{}{"country": map[string]interface{}{"iso_code": location[0]}}
+		if location[1] != "" {
+			entry["subdivisions"] = []interface{}{map[string]interface{}{"iso_code": location[1]}}
+		}
+		offset := data.Len()
+		encode(&data, entry)
+		ones, _ := network.Mask.Size()
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(network.IP.To4()[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = dataBit | offset
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+	var file bytes.Buffer
+	for _, node := range nodes {
+		for _, record := range node {
+			switch {
+			case record == empty:
+				record = len(nodes)
+			case record&dataBit != 0:
+				record = len(nodes) + 16 + record&^dataBit
+			}
+			file.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&file, map[string]interface{}{
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               "Test-Country",
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(buildTime.Unix()),
+		"description":                 map[string]interface{}{"en": "test"},
+	})
+	assert.NoError(t, os.WriteFile(path, file.Bytes(), 0644))
+}
+
+func encode(buf *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case string:
+		buf.WriteByte(2<<5 | byte(len(value)))
+		buf.WriteString(value)
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		binary.Write(buf, binary.BigEndian, value)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		binary.Write(buf, binary.BigEndian, value)
+	case uint64:
+		buf.Write([]byte{8, 9 - 7})
+		binary.Write(buf, binary.BigEndian, value)
+	case []interface{}:
+		buf.Write([]byte{byte(len(value)), 11 - 7})
+		for _, v := range value {
+			encode(buf, v)
+		}
+	case map[string]interface{}:
+		buf.WriteByte(7<<5 | byte(len(value)))
+		for k, v := range value {
+			encode(buf, k)
+			encode(buf, v)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	writeDatabase(t, path, map[string][2]string{
+		"2.125.160.0/24": {"GB", "ENG"},
+		"67.43.156.0/24": {"US", ""},
+	})
+
+	database := NewDatabase(path, 0)
+	assert.NoError(database.Reload())
+	defer database.Close()
+
+	location, err := database.Locate(net.ParseIP("2.125.160.216"))
+	assert.NoError(err)
+	assert.Equal(Location{Country: "GB", Region: "GB-ENG"}, location)
+
+	location, err = database.Locate(net.ParseIP("67.43.156.1"))
+	assert.NoError(err)
+	assert.Equal(Location{Country: "US"}, location)
+
+	location, err = database.Locate(net.ParseIP("10.0.0.1"))
+	assert.NoError(err)
+	assert.Equal(Location{}, location, "unknown network")
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	writeDatabase(t, path, map[string][2]string{"2.125.160.0/24": {"GB", ""}})
+
+	database := NewDatabase(path, 0)
+	assert.NoError(database.Reload())
+	defer database.Close()
+
+	writeDatabase(t, path, map[string][2]string{"2.125.160.0/24": {"IE", ""}})
+	later := time.Now().Add(time.Minute)
+	assert.NoError(os.Chtimes(path, later, later))
+	assert.NoError(database.Reload())
+
+	location, err := database.Locate(net.ParseIP("2.125.160.216"))
+	assert.NoError(err)
+	assert.Equal("IE", location.Country, "reloaded after the file changed")
+
+	assert.NoError(os.Remove(path))
+	assert.Error(database.Reload())
+	_, err = database.Locate(net.ParseIP("2.125.160.216"))
+	assert.Equal(ErrUnavailable, err, "missing file fails safe")
+}
+
+func TestMissingDatabase(t *testing.T) {
+	database := NewDatabase(filepath.Join(t.TempDir(), "missing.mmdb"), 0)
+	assert.Error(t, database.Reload())
+
+	_, err := database.Locate(net.ParseIP("2.125.160.216"))
+	assert.Equal(t, ErrUnavailable, err)
+}
+
+func TestStaleDatabase(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	writeDatabase(t, path, map[string][2]string{"2.125.160.0/24": {"GB", ""}})
+
+	database := NewDatabase(path, 30*24*time.Hour)
+	database.now = func() time.Time { return buildTime.Add(7 * 24 * time.Hour) }
+	assert.NoError(database.Reload())
+	defer database.Close()
+
+	_, err := database.Locate(net.ParseIP("2.125.160.216"))
+	assert.NoError(err)
+
+	database.now = func() time.Time { return buildTime.Add(60 * 24 * time.Hour) }
+	_, err = database.Locate(net.ParseIP("2.125.160.216"))
+	assert.Equal(ErrUnavailable, err, "stale database fails safe")
+}
@@ -0,0 +1,80 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Elector decides which replica of the service is allowed to run background jobs
+type Elector interface {
+	// Campaign acquires or renews leadership and reports whether this instance is the leader
+	Campaign() (bool, error)
+	// Resign gives up leadership so another instance can take over
+	Resign() error
+}
+
+// Monitor campaigns for leadership on an interval and tracks whether this instance is the leader
+type Monitor struct {
+	Elector  Elector
+	Interval time.Duration
+	leading  int32
+}
+
+// IsLeader reports whether the last campaign made this instance the leader
+func (m *Monitor) IsLeader() bool {
+	return atomic.LoadInt32(&m.leading) == 1
+}
+
+// Campaign runs a single campaign and records the result
+func (m *Monitor) Campaign() {
+	leading, err := m.Elector.Campaign()
+	if err != nil {
+		log.WithError(err).Error("Unable to campaign for leadership")
+		leading = false
+	}
+	var state int32
+	if leading {
+		state = 1
+	}
+	if previous := atomic.SwapInt32(&m.leading, state); previous != state {
+		log.WithField("leader", leading).Info("Leadership changed")
+	}
+}
+
+// Run campaigns for leadership until the context is cancelled, then resigns
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		m.Campaign()
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&m.leading, 0)
+			if err := m.Elector.Resign(); err != nil {
+				log.WithError(err).Error("Unable to resign leadership")
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewID generates an identifier for this instance that is unique across replicas
+func NewID() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b)), nil
+}
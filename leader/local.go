@@ -0,0 +1,50 @@
+package leader
+
+import (
+	"sync"
+	"time"
+)
+
+// LocalLock is an in-process lease shared by local Electors, for single node deployments and tests
+type LocalLock struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	holder  string
+	expires time.Time
+}
+
+// NewLocalLock creates a LocalLock whose lease lasts for ttl
+func NewLocalLock(ttl time.Duration) *LocalLock {
+	return &LocalLock{ttl: ttl}
+}
+
+// Elector returns an Elector that competes for the lock on behalf of id
+func (l *LocalLock) Elector(id string) Elector {
+	return &localElector{lock: l, id: id}
+}
+
+type localElector struct {
+	lock *LocalLock
+	id   string
+}
+
+func (e *localElector) Campaign() (bool, error) {
+	e.lock.mu.Lock()
+	defer e.lock.mu.Unlock()
+	now := time.Now()
+	if e.lock.holder != "" && e.lock.holder != e.id && now.Before(e.lock.expires) {
+		return false, nil
+	}
+	e.lock.holder = e.id
+	e.lock.expires = now.Add(e.lock.ttl)
+	return true, nil
+}
+
+func (e *localElector) Resign() error {
+	e.lock.mu.Lock()
+	defer e.lock.mu.Unlock()
+	if e.lock.holder == e.id {
+		e.lock.holder = ""
+	}
+	return nil
+}
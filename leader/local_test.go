@@ -0,0 +1,73 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalElectorSingleLeader(t *testing.T) {
+	assert := assert.New(t)
+	lock := NewLocalLock(time.Minute)
+	first := lock.Elector("first")
+	second := lock.Elector("second")
+
+	leading, err := first.Campaign()
+	assert.NoError(err)
+	assert.True(leading, "first campaign takes the lock")
+
+	leading, err = second.Campaign()
+	assert.NoError(err)
+	assert.False(leading, "lock is held by first")
+
+	leading, err = first.Campaign()
+	assert.NoError(err)
+	assert.True(leading, "leader renews its lease")
+}
+
+func TestLocalElectorResign(t *testing.T) {
+	assert := assert.New(t)
+	lock := NewLocalLock(time.Minute)
+	first := lock.Elector("first")
+	second := lock.Elector("second")
+
+	first.Campaign()
+	assert.NoError(first.Resign())
+
+	leading, err := second.Campaign()
+	assert.NoError(err)
+	assert.True(leading, "lock is free after resigning")
+}
+
+func TestLocalElectorFailover(t *testing.T) {
+	assert := assert.New(t)
+	lock := NewLocalLock(10 * time.Millisecond)
+	first := lock.Elector("first")
+	second := lock.Elector("second")
+
+	first.Campaign()
+	time.Sleep(20 * time.Millisecond)
+
+	leading, err := second.Campaign()
+	assert.NoError(err)
+	assert.True(leading, "expired lease is taken over")
+
+	leading, err = first.Campaign()
+	assert.NoError(err)
+	assert.False(leading, "previous leader lost the lease")
+}
+
+func TestMonitor(t *testing.T) {
+	assert := assert.New(t)
+	lock := NewLocalLock(time.Minute)
+	lock.Elector("other").Campaign()
+	monitor := &Monitor{Elector: lock.Elector("self")}
+
+	monitor.Campaign()
+	assert.False(monitor.IsLeader())
+
+	lock.Elector("other").Resign()
+	monitor.Campaign()
+	assert.True(monitor.IsLeader())
+}
@@ -0,0 +1,61 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+)
+
+// PostgresElector implements Elector with a session level Postgres advisory lock
+type PostgresElector struct {
+	db   *sql.DB
+	key  int64
+	conn *sql.Conn
+}
+
+// NewPostgresElector creates an Elector that competes for the advisory lock derived from name
+func NewPostgresElector(db *sql.DB, name string) *PostgresElector {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &PostgresElector{db: db, key: int64(h.Sum64())}
+}
+
+// Campaign checks that the session holding the lock is still alive, or tries to take the lock on a new session
+func (e *PostgresElector) Campaign() (bool, error) {
+	ctx := context.Background()
+	if e.conn != nil {
+		if _, err := e.conn.ExecContext(ctx, "SELECT 1"); err == nil {
+			return true, nil
+		}
+		e.conn.Close()
+		e.conn = nil
+	}
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+	e.conn = conn
+	return true, nil
+}
+
+// Resign releases the advisory lock and closes the session holding it
+func (e *PostgresElector) Resign() error {
+	if e.conn == nil {
+		return nil
+	}
+	defer func() {
+		e.conn.Close()
+		e.conn = nil
+	}()
+	_, err := e.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", e.key)
+	return err
+}
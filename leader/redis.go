@@ -0,0 +1,54 @@
+package leader
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// RedisElector implements Elector with a lease held on a Redis key
+type RedisElector struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+}
+
+// NewRedisElector creates an Elector that holds the lease key for ttl on behalf of id
+func NewRedisElector(client *redis.Client, key, id string, ttl time.Duration) *RedisElector {
+	return &RedisElector{client: client, key: key, id: id, ttl: ttl}
+}
+
+// Campaign takes the lease if it is free, or extends it if this instance already holds it
+func (e *RedisElector) Campaign() (bool, error) {
+	acquired, err := e.client.SetNX(e.key, e.id, e.ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	if acquired {
+		return true, nil
+	}
+	renewed, err := renewScript.Run(e.client, []string{e.key}, e.id, int64(e.ttl/time.Millisecond)).Result()
+	if err != nil {
+		return false, err
+	}
+	return renewed == int64(1), nil
+}
+
+// Resign releases the lease if this instance holds it
+func (e *RedisElector) Resign() error {
+	return releaseScript.Run(e.client, []string{e.key}, e.id).Err()
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+)
+
+// Cache wraps a cache.Cache and records the latency, errors and hit ratio of every operation
+type Cache struct {
+	cache.Cache
+}
+
+// InstrumentCache wraps c with metrics
+func InstrumentCache(c cache.Cache) *Cache {
+	return &Cache{c}
+}
+
+// SetURL records metrics for Cache.SetURL
+func (c *Cache) SetURL(ctx context.Context, shortener *cache.Shortener, ttl time.Duration) (err error) {
+	defer func(start time.Time) { observe(CacheDuration, CacheErrors, "set_url", start, err) }(time.Now())
+	return c.Cache.SetURL(ctx, shortener, ttl)
+}
+
+// GetURL records metrics for Cache.GetURL, counting misses separately from errors
+func (c *Cache) GetURL(ctx context.Context, token string) (*cache.Shortener, error) {
+	start := time.Now()
+	shortener, err := c.Cache.GetURL(ctx, token)
+	switch err {
+	case nil:
+		CacheLookups.WithLabelValues("hit").Inc()
+		observe(CacheDuration, CacheErrors, "get_url", start, nil)
+	case cache.ErrNotFound:
+		CacheLookups.WithLabelValues("miss").Inc()
+		observe(CacheDuration, CacheErrors, "get_url", start, nil)
+	default:
+		CacheLookups.WithLabelValues("error").Inc()
+		observe(CacheDuration, CacheErrors, "get_url", start, err)
+	}
+	return shortener, err
+}
+
+// DeleteURL records metrics for Cache.DeleteURL
+func (c *Cache) DeleteURL(ctx context.Context, token string) (err error) {
+	defer func(start time.Time) { observe(CacheDuration, CacheErrors, "delete_url", start, err) }(time.Now())
+	return c.Cache.DeleteURL(ctx, token)
+}
+
+// Ping records metrics for Cache.Ping
+func (c *Cache) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { observe(CacheDuration, CacheErrors, "ping", start, err) }(time.Now())
+	return c.Cache.Ping(ctx)
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "snip"
+
+var (
+	// Registry holds every metric exported by the service
+	Registry = prometheus.NewRegistry()
+
+	// RequestsTotal counts HTTP requests by route name, method and status code
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// RequestDuration observes HTTP request latency by route name and method
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// Redirects counts redirect lookups that found (hit) or did not find (miss) a URL
+	Redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Redirect requests by result (hit or miss).",
+	}, []string{"result"})
+
+	// CacheLookups counts cache reads by result, hit ratio is hit / (hit + miss)
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by result (hit, miss or error).",
+	}, []string{"result"})
+
+	// StoreDuration observes store operation latency
+	StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Store operation latency by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// StoreErrors counts failed store operations
+	StoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_operation_errors_total",
+		Help:      "Failed store operations by operation.",
+	}, []string{"operation"})
+
+	// CacheDuration observes cache operation latency
+	CacheDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cache_operation_duration_seconds",
+		Help:      "Cache operation latency by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// CacheErrors counts failed cache operations
+	CacheErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_operation_errors_total",
+		Help:      "Failed cache operations by operation.",
+	}, []string{"operation"})
+
+	// RateLimited counts requests rejected by the rate limiter by policy
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by policy.",
+	}, []string{"policy"})
+
+	// LinksCreated counts registered short URLs
+	LinksCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_created_total",
+		Help:      "Short URLs registered.",
+	})
+
+	// LinksExpired counts short URLs removed by the expiry sweeper
+	LinksExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_expired_total",
+		Help:      "Short URLs removed by the expiry sweeper.",
+	})
+
+	// LinksPurged counts deleted short URLs removed from the trash after retention
+	LinksPurged = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_purged_total",
+		Help:      "Deleted short URLs purged from the trash.",
+	})
+
+	// WebhookDeliveries counts webhook delivery attempts by result
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result (delivered, retry or failed).",
+	}, []string{"result"})
+
+	// SweepExpired observes how many short URLs each sweep removed
+	SweepExpired = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sweep_expired_links",
+		Help:      "Short URLs removed per expiry sweep.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestsTotal,
+		RequestDuration,
+		Redirects,
+		CacheLookups,
+		StoreDuration,
+		StoreErrors,
+		CacheDuration,
+		CacheErrors,
+		RateLimited,
+		LinksCreated,
+		LinksExpired,
+		LinksPurged,
+		WebhookDeliveries,
+		SweepExpired,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+func observe(duration *prometheus.HistogramVec, errors *prometheus.CounterVec, operation string, start time.Time, err error) {
+	duration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		errors.WithLabelValues(operation).Inc()
+	}
+}
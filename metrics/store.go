@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+)
+
+// Store wraps a db.Store and records the latency and errors of every operation
+type Store struct {
+	db.Store
+}
+
+// InstrumentStore wraps store with metrics
+func InstrumentStore(store db.Store) *Store {
+	return &Store{store}
+}
+
+// observeStore records a store operation. The errors the store returns for
+// expected outcomes, like a token that does not exist, are not counted as errors.
+func observeStore(operation string, start time.Time, err error) {
+	switch err {
+	case db.ErrNotFound, db.ErrTagExists, db.ErrMatchChanged, db.ErrCreationQuota, db.ErrActiveLinkQuota:
+		err = nil
+	}
+	observe(StoreDuration, StoreErrors, operation, start, err)
+}
+
+// GetShortURL records metrics for Store.GetShortURL
+func (s *Store) GetShortURL(ctx context.Context, token string) (shortURL *db.ShortURL, err error) {
+	defer func(start time.Time) { observeStore("get_short_url", start, err) }(time.Now())
+	return s.Store.GetShortURL(ctx, token)
+}
+
+// GetAllURLTokens records metrics for Store.GetAllURLTokens
+func (s *Store) GetAllURLTokens(ctx context.Context) (tokens []string, err error) {
+	defer func(start time.Time) { observeStore("get_all_url_tokens", start, err) }(time.Now())
+	return s.Store.GetAllURLTokens(ctx)
+}
+
+// CreateShortURL records metrics for Store.CreateShortURL
+func (s *Store) CreateShortURL(ctx context.Context, shortURL *db.ShortURL, claim *db.QuotaClaim, events db.Events) (err error) {
+	defer func(start time.Time) { observeStore("create_short_url", start, err) }(time.Now())
+	return s.Store.CreateShortURL(ctx, shortURL, claim, events)
+}
+
+// UpdateShortURL records metrics for Store.UpdateShortURL
+func (s *Store) UpdateShortURL(ctx context.Context, shortURL *db.ShortURL) (err error) {
+	defer func(start time.Time) { observeStore("update_short_url", start, err) }(time.Now())
+	return s.Store.UpdateShortURL(ctx, shortURL)
+}
+
+// IncrementRedirects records metrics for Store.IncrementRedirects
+func (s *Store) IncrementRedirects(ctx context.Context, token string, events db.Events) (redirects int, err error) {
+	defer func(start time.Time) { observeStore("increment_redirects", start, err) }(time.Now())
+	return s.Store.IncrementRedirects(ctx, token, events)
+}
+
+// UpdateLink records metrics for Store.UpdateLink
+func (s *Store) UpdateLink(ctx context.Context, token string, update *db.LinkUpdate, events db.Events) (shortURL *db.ShortURL, err error) {
+	defer func(start time.Time) { observeStore("update_link", start, err) }(time.Now())
+	return s.Store.UpdateLink(ctx, token, update, events)
+}
+
+// SetStatus records metrics for Store.SetStatus
+func (s *Store) SetStatus(ctx context.Context, token string, change *db.StatusChange, events db.Events) (shortURL *db.ShortURL, err error) {
+	defer func(start time.Time) { observeStore("set_status", start, err) }(time.Now())
+	return s.Store.SetStatus(ctx, token, change, events)
+}
+
+// DeleteShortURL records metrics for Store.DeleteShortURL
+func (s *Store) DeleteShortURL(ctx context.Context, token string, events db.Events) (err error) {
+	defer func(start time.Time) { observeStore("delete_short_url", start, err) }(time.Now())
+	return s.Store.DeleteShortURL(ctx, token, events)
+}
+
+// TokenExists records metrics for Store.TokenExists
+func (s *Store) TokenExists(ctx context.Context, token string) (exists bool, err error) {
+	defer func(start time.Time) { observeStore("token_exists", start, err) }(time.Now())
+	return s.Store.TokenExists(ctx, token)
+}
+
+// ListDeleted records metrics for Store.ListDeleted
+func (s *Store) ListDeleted(ctx context.Context, limit, offset int) (shortURLs db.ShortURLS, err error) {
+	defer func(start time.Time) { observeStore("list_deleted", start, err) }(time.Now())
+	return s.Store.ListDeleted(ctx, limit, offset)
+}
+
+// RestoreShortURLs records metrics for Store.RestoreShortURLs
+func (s *Store) RestoreShortURLs(ctx context.Context, tokens []string, events db.Events) (restored []string, err error) {
+	defer func(start time.Time) { observeStore("restore_short_urls", start, err) }(time.Now())
+	return s.Store.RestoreShortURLs(ctx, tokens, events)
+}
+
+// PurgeDeleted records metrics for Store.PurgeDeleted
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time, limit int) (tokens []string, err error) {
+	defer func(start time.Time) { observeStore("purge_deleted", start, err) }(time.Now())
+	return s.Store.PurgeDeleted(ctx, before, limit)
+}
+
+// MatchLinks records metrics for Store.MatchLinks
+func (s *Store) MatchLinks(ctx context.Context, filter *db.LinkFilter, sample int) (match *db.LinkMatch, err error) {
+	defer func(start time.Time) { observeStore("match_links", start, err) }(time.Now())
+	return s.Store.MatchLinks(ctx, filter, sample)
+}
+
+// DeleteLinks records metrics for Store.DeleteLinks
+func (s *Store) DeleteLinks(ctx context.Context, filter *db.LinkFilter, digest string, events db.Events) (tokens []string, err error) {
+	defer func(start time.Time) { observeStore("delete_links", start, err) }(time.Now())
+	return s.Store.DeleteLinks(ctx, filter, digest, events)
+}
+
+// RecordAudit records metrics for Store.RecordAudit
+func (s *Store) RecordAudit(ctx context.Context, entry *db.AuditEntry) (err error) {
+	defer func(start time.Time) { observeStore("record_audit", start, err) }(time.Now())
+	return s.Store.RecordAudit(ctx, entry)
+}
+
+// ListAudit records metrics for Store.ListAudit
+func (s *Store) ListAudit(ctx context.Context, filter *db.AuditFilter) (entries []db.AuditEntry, err error) {
+	defer func(start time.Time) { observeStore("list_audit", start, err) }(time.Now())
+	return s.Store.ListAudit(ctx, filter)
+}
+
+// CreateWebhook records metrics for Store.CreateWebhook
+func (s *Store) CreateWebhook(ctx context.Context, webhook *db.Webhook) (err error) {
+	defer func(start time.Time) { observeStore("create_webhook", start, err) }(time.Now())
+	return s.Store.CreateWebhook(ctx, webhook)
+}
+
+// GetWebhook records metrics for Store.GetWebhook
+func (s *Store) GetWebhook(ctx context.Context, id uint) (webhook *db.Webhook, err error) {
+	defer func(start time.Time) { observeStore("get_webhook", start, err) }(time.Now())
+	return s.Store.GetWebhook(ctx, id)
+}
+
+// ListWebhooks records metrics for Store.ListWebhooks
+func (s *Store) ListWebhooks(ctx context.Context) (webhooks []db.Webhook, err error) {
+	defer func(start time.Time) { observeStore("list_webhooks", start, err) }(time.Now())
+	return s.Store.ListWebhooks(ctx)
+}
+
+// DeleteWebhook records metrics for Store.DeleteWebhook
+func (s *Store) DeleteWebhook(ctx context.Context, id uint) (err error) {
+	defer func(start time.Time) { observeStore("delete_webhook", start, err) }(time.Now())
+	return s.Store.DeleteWebhook(ctx, id)
+}
+
+// ClaimDeliveries records metrics for Store.ClaimDeliveries
+func (s *Store) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) (deliveries []db.WebhookDelivery, err error) {
+	defer func(start time.Time) { observeStore("claim_deliveries", start, err) }(time.Now())
+	return s.Store.ClaimDeliveries(ctx, now, until, limit)
+}
+
+// UpdateDelivery records metrics for Store.UpdateDelivery
+func (s *Store) UpdateDelivery(ctx context.Context, delivery *db.WebhookDelivery) (err error) {
+	defer func(start time.Time) { observeStore("update_delivery", start, err) }(time.Now())
+	return s.Store.UpdateDelivery(ctx, delivery)
+}
+
+// ListDeliveries records metrics for Store.ListDeliveries
+func (s *Store) ListDeliveries(ctx context.Context, webhookID uint, limit int) (deliveries []db.WebhookDelivery, err error) {
+	defer func(start time.Time) { observeStore("list_deliveries", start, err) }(time.Now())
+	return s.Store.ListDeliveries(ctx, webhookID, limit)
+}
+
+// DeleteExpired records metrics for Store.DeleteExpired
+func (s *Store) DeleteExpired(ctx context.Context, before time.Time, limit int, events db.Events) (tokens []string, err error) {
+	defer func(start time.Time) { observeStore("delete_expired", start, err) }(time.Now())
+	return s.Store.DeleteExpired(ctx, before, limit, events)
+}
+
+// TokenExpired records metrics for Store.TokenExpired
+func (s *Store) TokenExpired(ctx context.Context, token string) (expired bool, err error) {
+	defer func(start time.Time) { observeStore("token_expired", start, err) }(time.Now())
+	return s.Store.TokenExpired(ctx, token)
+}
+
+// PurgeTombstones records metrics for Store.PurgeTombstones
+func (s *Store) PurgeTombstones(ctx context.Context, before time.Time) (count int, err error) {
+	defer func(start time.Time) { observeStore("purge_tombstones", start, err) }(time.Now())
+	return s.Store.PurgeTombstones(ctx, before)
+}
+
+// CollectStats records metrics for Store.CollectStats
+func (s *Store) CollectStats(ctx context.Context, filter *db.LinkFilter) (stats *db.Stats, err error) {
+	defer func(start time.Time) { observeStore("collect_stats", start, err) }(time.Now())
+	return s.Store.CollectStats(ctx, filter)
+}
+
+// ListLinks records metrics for Store.ListLinks
+func (s *Store) ListLinks(ctx context.Context, filter *db.LinkFilter, limit, offset int) (shortURLs db.ShortURLS, err error) {
+	defer func(start time.Time) { observeStore("list_links", start, err) }(time.Now())
+	return s.Store.ListLinks(ctx, filter, limit, offset)
+}
+
+// ListTags records metrics for Store.ListTags
+func (s *Store) ListTags(ctx context.Context) (tags []db.TagCount, err error) {
+	defer func(start time.Time) { observeStore("list_tags", start, err) }(time.Now())
+	return s.Store.ListTags(ctx)
+}
+
+// RenameTag records metrics for Store.RenameTag
+func (s *Store) RenameTag(ctx context.Context, from, to string) (err error) {
+	defer func(start time.Time) { observeStore("rename_tag", start, err) }(time.Now())
+	return s.Store.RenameTag(ctx, from, to)
+}
+
+// DeleteTag records metrics for Store.DeleteTag
+func (s *Store) DeleteTag(ctx context.Context, name string) (err error) {
+	defer func(start time.Time) { observeStore("delete_tag", start, err) }(time.Now())
+	return s.Store.DeleteTag(ctx, name)
+}
+
+// ListFolders records metrics for Store.ListFolders
+func (s *Store) ListFolders(ctx context.Context) (folders []db.FolderCount, err error) {
+	defer func(start time.Time) { observeStore("list_folders", start, err) }(time.Now())
+	return s.Store.ListFolders(ctx)
+}
+
+// ListInterstitialDomains records metrics for Store.ListInterstitialDomains
+func (s *Store) ListInterstitialDomains(ctx context.Context) (domains []db.InterstitialDomain, err error) {
+	defer func(start time.Time) { observeStore("list_interstitial_domains", start, err) }(time.Now())
+	return s.Store.ListInterstitialDomains(ctx)
+}
+
+// AddInterstitialDomain records metrics for Store.AddInterstitialDomain
+func (s *Store) AddInterstitialDomain(ctx context.Context, domain *db.InterstitialDomain) (err error) {
+	defer func(start time.Time) { observeStore("add_interstitial_domain", start, err) }(time.Now())
+	return s.Store.AddInterstitialDomain(ctx, domain)
+}
+
+// DeleteInterstitialDomain records metrics for Store.DeleteInterstitialDomain
+func (s *Store) DeleteInterstitialDomain(ctx context.Context, domain string) (err error) {
+	defer func(start time.Time) { observeStore("delete_interstitial_domain", start, err) }(time.Now())
+	return s.Store.DeleteInterstitialDomain(ctx, domain)
+}
+
+// IncrementClicks records metrics for Store.IncrementClicks
+func (s *Store) IncrementClicks(ctx context.Context, token, dimension, value string) (err error) {
+	defer func(start time.Time) { observeStore("increment_clicks", start, err) }(time.Now())
+	return s.Store.IncrementClicks(ctx, token, dimension, value)
+}
+
+// GetClicks records metrics for Store.GetClicks
+func (s *Store) GetClicks(ctx context.Context, token string) (clicks map[string]map[string]int, err error) {
+	defer func(start time.Time) { observeStore("get_clicks", start, err) }(time.Now())
+	return s.Store.GetClicks(ctx, token)
+}
+
+// CountActiveLinks records metrics for Store.CountActiveLinks
+func (s *Store) CountActiveLinks(ctx context.Context, owner string, now time.Time) (count int, err error) {
+	defer func(start time.Time) { observeStore("count_active_links", start, err) }(time.Now())
+	return s.Store.CountActiveLinks(ctx, owner, now)
+}
+
+// GetCreations records metrics for Store.GetCreations
+func (s *Store) GetCreations(ctx context.Context, owner string, periodStart time.Time) (count int, err error) {
+	defer func(start time.Time) { observeStore("get_creations", start, err) }(time.Now())
+	return s.Store.GetCreations(ctx, owner, periodStart)
+}
+
+// Ping records metrics for Store.Ping
+func (s *Store) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { observeStore("ping", start, err) }(time.Now())
+	return s.Store.Ping(ctx)
+}
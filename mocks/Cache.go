@@ -2,6 +2,7 @@
 package mocks
 
 import cache "github.com/derek-elliott/url-shortener/cache"
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import time "time"
 
@@ -10,13 +11,13 @@ type Cache struct {
 	mock.Mock
 }
 
-// DeleteURL provides a mock function with given fields: token
-func (_m *Cache) DeleteURL(token string) error {
-	ret := _m.Called(token)
+// Close provides a mock function with given fields:
+func (_m *Cache) Close() error {
+	ret := _m.Called()
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(token)
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -24,13 +25,27 @@ func (_m *Cache) DeleteURL(token string) error {
 	return r0
 }
 
-// GetURL provides a mock function with given fields: token
-func (_m *Cache) GetURL(token string) (*cache.Shortener, error) {
-	ret := _m.Called(token)
+// DeleteURL provides a mock function with given fields: ctx, token
+func (_m *Cache) DeleteURL(ctx context.Context, token string) error {
+	ret := _m.Called(ctx, token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetURL provides a mock function with given fields: ctx, token
+func (_m *Cache) GetURL(ctx context.Context, token string) (*cache.Shortener, error) {
+	ret := _m.Called(ctx, token)
 
 	var r0 *cache.Shortener
-	if rf, ok := ret.Get(0).(func(string) *cache.Shortener); ok {
-		r0 = rf(token)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *cache.Shortener); ok {
+		r0 = rf(ctx, token)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*cache.Shortener)
@@ -38,8 +53,8 @@ func (_m *Cache) GetURL(token string) (*cache.Shortener, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(token)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -61,13 +76,27 @@ func (_m *Cache) InitCache(pass string, host string, port int) error {
 	return r0
 }
 
-// SetURL provides a mock function with given fields: token, url, ttl
-func (_m *Cache) SetURL(token string, url string, ttl time.Duration) error {
-	ret := _m.Called(token, url, ttl)
+// Ping provides a mock function with given fields: ctx
+func (_m *Cache) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetURL provides a mock function with given fields: ctx, shortener, ttl
+func (_m *Cache) SetURL(ctx context.Context, shortener *cache.Shortener, ttl time.Duration) error {
+	ret := _m.Called(ctx, shortener, ttl)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, time.Duration) error); ok {
-		r0 = rf(token, url, ttl)
+	if rf, ok := ret.Get(0).(func(context.Context, *cache.Shortener, time.Duration) error); ok {
+		r0 = rf(ctx, shortener, ttl)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -1,21 +1,74 @@
 // Code generated by mockery v1.0.0. DO NOT EDIT.
 package mocks
 
+import context "context"
 import db "github.com/derek-elliott/url-shortener/db"
 import mock "github.com/stretchr/testify/mock"
+import time "time"
 
 // Store is an autogenerated mock type for the Store type
 type Store struct {
 	mock.Mock
 }
 
-// CollectStats provides a mock function with given fields:
-func (_m *Store) CollectStats() (*db.Stats, error) {
+// AddInterstitialDomain provides a mock function with given fields: ctx, domain
+func (_m *Store) AddInterstitialDomain(ctx context.Context, domain *db.InterstitialDomain) error {
+	ret := _m.Called(ctx, domain)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *db.InterstitialDomain) error); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimDeliveries provides a mock function with given fields: ctx, now, until, limit
+func (_m *Store) ClaimDeliveries(ctx context.Context, now time.Time, until time.Time, limit int) ([]db.WebhookDelivery, error) {
+	ret := _m.Called(ctx, now, until, limit)
+
+	var r0 []db.WebhookDelivery
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, time.Time, int) []db.WebhookDelivery); ok {
+		r0 = rf(ctx, now, until, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.WebhookDelivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, time.Time, int) error); ok {
+		r1 = rf(ctx, now, until, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Close provides a mock function with given fields:
+func (_m *Store) Close() error {
 	ret := _m.Called()
 
-	var r0 *db.Stats
-	if rf, ok := ret.Get(0).(func() *db.Stats); ok {
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
 		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CollectStats provides a mock function with given fields: ctx, filter
+func (_m *Store) CollectStats(ctx context.Context, filter *db.LinkFilter) (*db.Stats, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 *db.Stats
+	if rf, ok := ret.Get(0).(func(context.Context, *db.LinkFilter) *db.Stats); ok {
+		r0 = rf(ctx, filter)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*db.Stats)
@@ -23,8 +76,8 @@ func (_m *Store) CollectStats() (*db.Stats, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context, *db.LinkFilter) error); ok {
+		r1 = rf(ctx, filter)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -32,13 +85,34 @@ func (_m *Store) CollectStats() (*db.Stats, error) {
 	return r0, r1
 }
 
-// CreateShortURL provides a mock function with given fields: shortURL
-func (_m *Store) CreateShortURL(shortURL *db.ShortURL) error {
-	ret := _m.Called(shortURL)
+// CountActiveLinks provides a mock function with given fields: ctx, owner, now
+func (_m *Store) CountActiveLinks(ctx context.Context, owner string, now time.Time) (int, error) {
+	ret := _m.Called(ctx, owner, now)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) int); ok {
+		r0 = rf(ctx, owner, now)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, owner, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateShortURL provides a mock function with given fields: ctx, shortURL, claim, events
+func (_m *Store) CreateShortURL(ctx context.Context, shortURL *db.ShortURL, claim *db.QuotaClaim, events db.Events) error {
+	ret := _m.Called(ctx, shortURL, claim, events)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*db.ShortURL) error); ok {
-		r0 = rf(shortURL)
+	if rf, ok := ret.Get(0).(func(context.Context, *db.ShortURL, *db.QuotaClaim, db.Events) error); ok {
+		r0 = rf(ctx, shortURL, claim, events)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -46,13 +120,13 @@ func (_m *Store) CreateShortURL(shortURL *db.ShortURL) error {
 	return r0
 }
 
-// DeleteShortURL provides a mock function with given fields: token
-func (_m *Store) DeleteShortURL(token string) error {
-	ret := _m.Called(token)
+// CreateWebhook provides a mock function with given fields: ctx, webhook
+func (_m *Store) CreateWebhook(ctx context.Context, webhook *db.Webhook) error {
+	ret := _m.Called(ctx, webhook)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(token)
+	if rf, ok := ret.Get(0).(func(context.Context, *db.Webhook) error); ok {
+		r0 = rf(ctx, webhook)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -60,13 +134,115 @@ func (_m *Store) DeleteShortURL(token string) error {
 	return r0
 }
 
-// GetAllURLTokens provides a mock function with given fields:
-func (_m *Store) GetAllURLTokens() ([]string, error) {
-	ret := _m.Called()
+// DeleteExpired provides a mock function with given fields: ctx, before, limit, events
+func (_m *Store) DeleteExpired(ctx context.Context, before time.Time, limit int, events db.Events) ([]string, error) {
+	ret := _m.Called(ctx, before, limit, events)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func() []string); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int, db.Events) []string); ok {
+		r0 = rf(ctx, before, limit, events)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int, db.Events) error); ok {
+		r1 = rf(ctx, before, limit, events)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteInterstitialDomain provides a mock function with given fields: ctx, domain
+func (_m *Store) DeleteInterstitialDomain(ctx context.Context, domain string) error {
+	ret := _m.Called(ctx, domain)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteLinks provides a mock function with given fields: ctx, filter, digest, events
+func (_m *Store) DeleteLinks(ctx context.Context, filter *db.LinkFilter, digest string, events db.Events) ([]string, error) {
+	ret := _m.Called(ctx, filter, digest, events)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, *db.LinkFilter, string, db.Events) []string); ok {
+		r0 = rf(ctx, filter, digest, events)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *db.LinkFilter, string, db.Events) error); ok {
+		r1 = rf(ctx, filter, digest, events)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteShortURL provides a mock function with given fields: ctx, token, events
+func (_m *Store) DeleteShortURL(ctx context.Context, token string, events db.Events) error {
+	ret := _m.Called(ctx, token, events)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, db.Events) error); ok {
+		r0 = rf(ctx, token, events)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTag provides a mock function with given fields: ctx, name
+func (_m *Store) DeleteTag(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteWebhook provides a mock function with given fields: ctx, id
+func (_m *Store) DeleteWebhook(ctx context.Context, id uint) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetAllURLTokens provides a mock function with given fields: ctx
+func (_m *Store) GetAllURLTokens(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -74,8 +250,31 @@ func (_m *Store) GetAllURLTokens() ([]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetClicks provides a mock function with given fields: ctx, token
+func (_m *Store) GetClicks(ctx context.Context, token string) (map[string]map[string]int, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 map[string]map[string]int
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]map[string]int); ok {
+		r0 = rf(ctx, token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -83,13 +282,34 @@ func (_m *Store) GetAllURLTokens() ([]string, error) {
 	return r0, r1
 }
 
-// GetShortURL provides a mock function with given fields: token
-func (_m *Store) GetShortURL(token string) (*db.ShortURL, error) {
-	ret := _m.Called(token)
+// GetCreations provides a mock function with given fields: ctx, owner, periodStart
+func (_m *Store) GetCreations(ctx context.Context, owner string, periodStart time.Time) (int, error) {
+	ret := _m.Called(ctx, owner, periodStart)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) int); ok {
+		r0 = rf(ctx, owner, periodStart)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, owner, periodStart)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetShortURL provides a mock function with given fields: ctx, token
+func (_m *Store) GetShortURL(ctx context.Context, token string) (*db.ShortURL, error) {
+	ret := _m.Called(ctx, token)
 
 	var r0 *db.ShortURL
-	if rf, ok := ret.Get(0).(func(string) *db.ShortURL); ok {
-		r0 = rf(token)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *db.ShortURL); ok {
+		r0 = rf(ctx, token)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*db.ShortURL)
@@ -97,8 +317,66 @@ func (_m *Store) GetShortURL(token string) (*db.ShortURL, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(token)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWebhook provides a mock function with given fields: ctx, id
+func (_m *Store) GetWebhook(ctx context.Context, id uint) (*db.Webhook, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *db.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, uint) *db.Webhook); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*db.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncrementClicks provides a mock function with given fields: ctx, token, dimension, value
+func (_m *Store) IncrementClicks(ctx context.Context, token string, dimension string, value string) error {
+	ret := _m.Called(ctx, token, dimension, value)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, token, dimension, value)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IncrementRedirects provides a mock function with given fields: ctx, token, events
+func (_m *Store) IncrementRedirects(ctx context.Context, token string, events db.Events) (int, error) {
+	ret := _m.Called(ctx, token, events)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, db.Events) int); ok {
+		r0 = rf(ctx, token, events)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, db.Events) error); ok {
+		r1 = rf(ctx, token, events)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -120,13 +398,427 @@ func (_m *Store) InitDB(user string, pass string, name string, host string, port
 	return r0
 }
 
-// UpdateShortURL provides a mock function with given fields: shortURL
-func (_m *Store) UpdateShortURL(shortURL *db.ShortURL) error {
-	ret := _m.Called(shortURL)
+// ListAudit provides a mock function with given fields: ctx, filter
+func (_m *Store) ListAudit(ctx context.Context, filter *db.AuditFilter) ([]db.AuditEntry, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 []db.AuditEntry
+	if rf, ok := ret.Get(0).(func(context.Context, *db.AuditFilter) []db.AuditEntry); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.AuditEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *db.AuditFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeleted provides a mock function with given fields: ctx, limit, offset
+func (_m *Store) ListDeleted(ctx context.Context, limit int, offset int) (db.ShortURLS, error) {
+	ret := _m.Called(ctx, limit, offset)
+
+	var r0 db.ShortURLS
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) db.ShortURLS); ok {
+		r0 = rf(ctx, limit, offset)
+	} else {
+		r0 = ret.Get(0).(db.ShortURLS)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeliveries provides a mock function with given fields: ctx, webhookID, limit
+func (_m *Store) ListDeliveries(ctx context.Context, webhookID uint, limit int) ([]db.WebhookDelivery, error) {
+	ret := _m.Called(ctx, webhookID, limit)
+
+	var r0 []db.WebhookDelivery
+	if rf, ok := ret.Get(0).(func(context.Context, uint, int) []db.WebhookDelivery); ok {
+		r0 = rf(ctx, webhookID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.WebhookDelivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, int) error); ok {
+		r1 = rf(ctx, webhookID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListFolders provides a mock function with given fields: ctx
+func (_m *Store) ListFolders(ctx context.Context) ([]db.FolderCount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []db.FolderCount
+	if rf, ok := ret.Get(0).(func(context.Context) []db.FolderCount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.FolderCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListInterstitialDomains provides a mock function with given fields: ctx
+func (_m *Store) ListInterstitialDomains(ctx context.Context) ([]db.InterstitialDomain, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []db.InterstitialDomain
+	if rf, ok := ret.Get(0).(func(context.Context) []db.InterstitialDomain); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.InterstitialDomain)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListLinks provides a mock function with given fields: ctx, filter, limit, offset
+func (_m *Store) ListLinks(ctx context.Context, filter *db.LinkFilter, limit int, offset int) (db.ShortURLS, error) {
+	ret := _m.Called(ctx, filter, limit, offset)
+
+	var r0 db.ShortURLS
+	if rf, ok := ret.Get(0).(func(context.Context, *db.LinkFilter, int, int) db.ShortURLS); ok {
+		r0 = rf(ctx, filter, limit, offset)
+	} else {
+		r0 = ret.Get(0).(db.ShortURLS)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *db.LinkFilter, int, int) error); ok {
+		r1 = rf(ctx, filter, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTags provides a mock function with given fields: ctx
+func (_m *Store) ListTags(ctx context.Context) ([]db.TagCount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []db.TagCount
+	if rf, ok := ret.Get(0).(func(context.Context) []db.TagCount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.TagCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListWebhooks provides a mock function with given fields: ctx
+func (_m *Store) ListWebhooks(ctx context.Context) ([]db.Webhook, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []db.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context) []db.Webhook); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]db.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MatchLinks provides a mock function with given fields: ctx, filter, sample
+func (_m *Store) MatchLinks(ctx context.Context, filter *db.LinkFilter, sample int) (*db.LinkMatch, error) {
+	ret := _m.Called(ctx, filter, sample)
+
+	var r0 *db.LinkMatch
+	if rf, ok := ret.Get(0).(func(context.Context, *db.LinkFilter, int) *db.LinkMatch); ok {
+		r0 = rf(ctx, filter, sample)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*db.LinkMatch)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *db.LinkFilter, int) error); ok {
+		r1 = rf(ctx, filter, sample)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *Store) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeDeleted provides a mock function with given fields: ctx, before, limit
+func (_m *Store) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	ret := _m.Called(ctx, before, limit)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) []string); ok {
+		r0 = rf(ctx, before, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeTombstones provides a mock function with given fields: ctx, before
+func (_m *Store) PurgeTombstones(ctx context.Context, before time.Time) (int, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordAudit provides a mock function with given fields: ctx, entry
+func (_m *Store) RecordAudit(ctx context.Context, entry *db.AuditEntry) error {
+	ret := _m.Called(ctx, entry)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *db.AuditEntry) error); ok {
+		r0 = rf(ctx, entry)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RenameTag provides a mock function with given fields: ctx, from, to
+func (_m *Store) RenameTag(ctx context.Context, from string, to string) error {
+	ret := _m.Called(ctx, from, to)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, from, to)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreShortURLs provides a mock function with given fields: ctx, tokens, events
+func (_m *Store) RestoreShortURLs(ctx context.Context, tokens []string, events db.Events) ([]string, error) {
+	ret := _m.Called(ctx, tokens, events)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, []string, db.Events) []string); ok {
+		r0 = rf(ctx, tokens, events)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string, db.Events) error); ok {
+		r1 = rf(ctx, tokens, events)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetStatus provides a mock function with given fields: ctx, token, change, events
+func (_m *Store) SetStatus(ctx context.Context, token string, change *db.StatusChange, events db.Events) (*db.ShortURL, error) {
+	ret := _m.Called(ctx, token, change, events)
+
+	var r0 *db.ShortURL
+	if rf, ok := ret.Get(0).(func(context.Context, string, *db.StatusChange, db.Events) *db.ShortURL); ok {
+		r0 = rf(ctx, token, change, events)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*db.ShortURL)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *db.StatusChange, db.Events) error); ok {
+		r1 = rf(ctx, token, change, events)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TokenExists provides a mock function with given fields: ctx, token
+func (_m *Store) TokenExists(ctx context.Context, token string) (bool, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TokenExpired provides a mock function with given fields: ctx, token
+func (_m *Store) TokenExpired(ctx context.Context, token string) (bool, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateDelivery provides a mock function with given fields: ctx, delivery
+func (_m *Store) UpdateDelivery(ctx context.Context, delivery *db.WebhookDelivery) error {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *db.WebhookDelivery) error); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateLink provides a mock function with given fields: ctx, token, update, events
+func (_m *Store) UpdateLink(ctx context.Context, token string, update *db.LinkUpdate, events db.Events) (*db.ShortURL, error) {
+	ret := _m.Called(ctx, token, update, events)
+
+	var r0 *db.ShortURL
+	if rf, ok := ret.Get(0).(func(context.Context, string, *db.LinkUpdate, db.Events) *db.ShortURL); ok {
+		r0 = rf(ctx, token, update, events)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*db.ShortURL)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *db.LinkUpdate, db.Events) error); ok {
+		r1 = rf(ctx, token, update, events)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateShortURL provides a mock function with given fields: ctx, shortURL
+func (_m *Store) UpdateShortURL(ctx context.Context, shortURL *db.ShortURL) error {
+	ret := _m.Called(ctx, shortURL)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*db.ShortURL) error); ok {
-		r0 = rf(shortURL)
+	if rf, ok := ret.Get(0).(func(context.Context, *db.ShortURL) error); ok {
+		r0 = rf(ctx, shortURL)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const memoryCleanupInterval = time.Minute
+
+// MemoryLimiter implements Limiter with buckets held in process, limits are per replica
+type MemoryLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// NewMemoryLimiter creates an empty MemoryLimiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket for key
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, policy Policy) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.cleanup(now)
+
+	capacity := float64(policy.Capacity())
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now, policy: policy}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*policy.rate())
+	b.updated = now
+	if b.tokens < 1 {
+		return policy.result(false, b.tokens), nil
+	}
+	b.tokens--
+	return policy.result(true, b.tokens), nil
+}
+
+// cleanup drops buckets that have refilled completely, since they are equivalent to new ones
+func (l *MemoryLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < memoryCleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	for key, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.updated).Seconds()*b.policy.rate()
+		if refilled >= float64(b.policy.Capacity()) {
+			delete(l.buckets, key)
+		}
+	}
+}
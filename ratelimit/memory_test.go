@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiterBurst(t *testing.T) {
+	assert := assert.New(t)
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	policy := Policy{Requests: 1, Per: time.Second, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(context.Background(), "client", policy)
+		assert.NoError(err)
+		assert.True(res.Allowed, "within burst")
+		assert.Equal(3, res.Limit)
+		assert.Equal(2-i, res.Remaining)
+	}
+
+	res, err := limiter.Allow(context.Background(), "client", policy)
+	assert.NoError(err)
+	assert.False(res.Allowed, "burst exhausted")
+	assert.Equal(time.Second, res.RetryAfter)
+
+	res, err = limiter.Allow(context.Background(), "other", policy)
+	assert.NoError(err)
+	assert.True(res.Allowed, "keys have separate buckets")
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	assert := assert.New(t)
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	policy := Policy{Requests: 2, Per: time.Second}
+
+	limiter.Allow(context.Background(), "client", policy)
+	limiter.Allow(context.Background(), "client", policy)
+	res, _ := limiter.Allow(context.Background(), "client", policy)
+	assert.False(res.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	res, _ = limiter.Allow(context.Background(), "client", policy)
+	assert.True(res.Allowed, "one token refilled")
+}
+
+func TestMemoryLimiterCleanup(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	policy := Policy{Requests: 1, Per: time.Second}
+
+	limiter.Allow(context.Background(), "client", policy)
+	now = now.Add(2 * memoryCleanupInterval)
+	limiter.Allow(context.Background(), "other", policy)
+
+	assert.NotContains(t, limiter.buckets, "client", "refilled buckets are dropped")
+}
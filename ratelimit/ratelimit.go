@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// Limiter takes a token from the bucket identified by key, refilled according to policy
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (*Result, error)
+}
+
+// Policy describes a token bucket: Requests tokens are added every Per, up to Burst
+type Policy struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Result reports the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Validate checks the policy refills a bucket at a finite, positive rate
+func (p Policy) Validate() error {
+	if p.Requests <= 0 {
+		return errors.New("requests must be positive")
+	}
+	if p.Per <= 0 {
+		return errors.New("per must be a positive duration")
+	}
+	if p.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
+}
+
+// Capacity is the size of the bucket, defaulting to Requests when no Burst is set
+func (p Policy) Capacity() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Requests
+}
+
+// rate returns the number of tokens added per second
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Per.Seconds()
+}
+
+// result builds a Result from the tokens left in a bucket after a take
+func (p Policy) result(allowed bool, tokens float64) *Result {
+	capacity := p.Capacity()
+	rate := p.rate()
+	res := &Result{
+		Allowed:   allowed,
+		Limit:     capacity,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(capacity) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,15 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	assert.NoError(t, Policy{Requests: 1, Per: time.Second}.Validate())
+	assert.Error(t, Policy{Requests: 0, Per: time.Second}.Validate(), "no requests")
+	assert.Error(t, Policy{Requests: 1}.Validate(), "no period")
+	assert.Error(t, Policy{Requests: 1, Per: time.Second, Burst: -1}.Validate(), "negative burst")
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// takeScript refills the bucket for the time elapsed since it was last used and takes a
+// token if one is available. It returns whether a token was taken and the tokens left.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("hmget", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or capacity
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("hmset", KEYS[1], "tokens", tokens, "updated", now)
+redis.call("pexpire", KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}`)
+
+// RedisLimiter implements Limiter with buckets shared between replicas in Redis
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLimiter creates a RedisLimiter storing buckets under keys starting with prefix
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+// Allow takes a token from the bucket for key
+func (l *RedisLimiter) Allow(ctx context.Context, key string, policy Policy) (*Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	reply, err := takeScript.Run(l.client.WithContext(ctx), []string{l.prefix + key}, policy.Capacity(), policy.rate(), now).Result()
+	if err != nil {
+		return nil, err
+	}
+	values := reply.([]interface{})
+	allowed := values[0].(int64) == 1
+	tokens, err := strconv.ParseFloat(values[1].(string), 64)
+	if err != nil {
+		return nil, err
+	}
+	return policy.result(allowed, tokens), nil
+}
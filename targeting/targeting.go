@@ -0,0 +1,155 @@
+package targeting
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Operating systems a Rule can target
+const (
+	OSAndroid  = "android"
+	OSIOS      = "ios"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+	OSOther    = "other"
+)
+
+// Device classes a Rule can target
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceOther   = "other"
+)
+
+// Client describes the visitor a redirect is being resolved for
+type Client struct {
+	OS     string
+	Device string
+	Bot    bool
+	// Country and Region are empty when the client could not be located
+	Country string
+	Region  string
+}
+
+// Rule sends matching clients to URL. Conditions that are not set match every client.
+type Rule struct {
+	OS     string `json:"os,omitempty" msgpack:"o,omitempty"`
+	Device string `json:"device,omitempty" msgpack:"d,omitempty"`
+	Bot    *bool  `json:"bot,omitempty" msgpack:"b,omitempty"`
+	// Country is an ISO 3166-1 alpha-2 code and Region an ISO 3166-2 code such as US-CA
+	Country string `json:"country,omitempty" msgpack:"c,omitempty"`
+	Region  string `json:"region,omitempty" msgpack:"g,omitempty"`
+	URL     string `json:"url" msgpack:"u"`
+}
+
+// Rules are evaluated in order, the first matching Rule wins
+type Rules []Rule
+
+// Matches reports whether the client meets every condition of the rule
+func (r Rule) Matches(client Client) bool {
+	if r.OS != "" && r.OS != client.OS {
+		return false
+	}
+	if r.Device != "" && r.Device != client.Device {
+		return false
+	}
+	if r.Bot != nil && *r.Bot != client.Bot {
+		return false
+	}
+	if r.Country != "" && !strings.EqualFold(r.Country, client.Country) {
+		return false
+	}
+	if r.Region != "" && !strings.EqualFold(r.Region, client.Region) {
+		return false
+	}
+	return true
+}
+
+// Validate checks that every rule has a usable destination and known conditions
+func (r Rule) Validate() error {
+	if _, err := url.ParseRequestURI(r.URL); err != nil {
+		return fmt.Errorf("invalid rule url %q: %v", r.URL, err)
+	}
+	switch r.OS {
+	case "", OSAndroid, OSIOS, OSWindows, OSMacOS, OSLinux, OSChromeOS, OSOther:
+	default:
+		return fmt.Errorf("unknown os %q", r.OS)
+	}
+	switch r.Device {
+	case "", DeviceMobile, DeviceTablet, DeviceDesktop, DeviceOther:
+	default:
+		return fmt.Errorf("unknown device %q", r.Device)
+	}
+	if r.Country != "" && len(r.Country) != 2 {
+		return fmt.Errorf("country %q is not an ISO 3166-1 alpha-2 code", r.Country)
+	}
+	if r.Region != "" && (len(r.Region) < 4 || r.Region[2] != '-') {
+		return fmt.Errorf("region %q is not an ISO 3166-2 code", r.Region)
+	}
+	return nil
+}
+
+// Destination returns the URL of the first rule the client matches
+func (rs Rules) Destination(client Client) (string, bool) {
+	for _, rule := range rs {
+		if rule.Matches(client) {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+// Validate checks every rule
+func (rs Rules) Validate() error {
+	for i, rule := range rs {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Value stores the rules as JSON
+func (rs Rules) Value() (driver.Value, error) {
+	if len(rs) == 0 {
+		return "", nil
+	}
+	return jsonValue(rs)
+}
+
+// Scan reads rules stored as JSON
+func (rs *Rules) Scan(src interface{}) error {
+	*rs = nil
+	return scanJSON(src, rs)
+}
+
+func jsonValue(v interface{}) (driver.Value, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	var value []byte
+	switch src := src.(type) {
+	case nil:
+	case string:
+		value = []byte(src)
+	case []byte:
+		value = src
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, dest)
+	}
+	if len(value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(value, dest)
+}
@@ -0,0 +1,90 @@
+package targeting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	bot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Client{OS: OSIOS, Device: DeviceMobile}, ParseUserAgent(iPhone))
+	assert.Equal(Client{OS: OSAndroid, Device: DeviceMobile}, ParseUserAgent(android))
+	assert.Equal(Client{OS: OSWindows, Device: DeviceDesktop}, ParseUserAgent(windows))
+	assert.True(ParseUserAgent(bot).Bot)
+}
+
+func TestRulesDestination(t *testing.T) {
+	assert := assert.New(t)
+	human := false
+	rules := Rules{
+		{OS: OSIOS, Bot: &human, URL: "https://apps.apple.com/app/id1"},
+		{OS: OSAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+		{Device: DeviceDesktop, URL: "https://www.example.com/desktop"},
+	}
+
+	destination, ok := rules.Destination(ParseUserAgent(iPhone))
+	assert.True(ok)
+	assert.Equal("https://apps.apple.com/app/id1", destination)
+
+	destination, ok = rules.Destination(ParseUserAgent(android))
+	assert.True(ok)
+	assert.Equal("https://play.google.com/store/apps/details?id=app", destination)
+
+	_, ok = rules.Destination(ParseUserAgent(bot))
+	assert.False(ok, "no rule for bots falls back to the default destination")
+}
+
+func TestRulesValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Rules{{OS: OSIOS, URL: "https://apps.apple.com"}}.Validate())
+	assert.Error(Rules{{OS: "beos", URL: "https://www.example.com"}}.Validate())
+	assert.Error(Rules{{Device: "watch", URL: "https://www.example.com"}}.Validate())
+	assert.Error(Rules{{OS: OSIOS, URL: "not a url"}}.Validate())
+}
+
+func TestRulesScan(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{{OS: OSIOS, URL: "https://apps.apple.com"}}
+	value, err := rules.Value()
+	assert.NoError(err)
+
+	var scanned Rules
+	assert.NoError(scanned.Scan(value))
+	assert.Equal(rules, scanned)
+
+	assert.NoError(scanned.Scan(nil))
+	assert.Nil(scanned)
+}
+
+func TestGeoRules(t *testing.T) {
+	assert := assert.New(t)
+	rules := Rules{
+		{Region: "US-CA", URL: "https://www.example.com/california"},
+		{Country: "us", URL: "https://www.example.com/us"},
+		{Country: "DE", URL: "https://www.example.de"},
+	}
+	assert.NoError(rules.Validate())
+
+	destination, _ := rules.Destination(Client{Country: "US", Region: "US-CA"})
+	assert.Equal("https://www.example.com/california", destination)
+
+	destination, _ = rules.Destination(Client{Country: "US", Region: "US-NY"})
+	assert.Equal("https://www.example.com/us", destination)
+
+	_, ok := rules.Destination(Client{})
+	assert.False(ok, "unlocated clients fall back to the default destination")
+
+	assert.Error(Rules{{Country: "USA", URL: "https://www.example.com"}}.Validate())
+	assert.Error(Rules{{Region: "CA", URL: "https://www.example.com"}}.Validate())
+}
@@ -0,0 +1,34 @@
+package targeting
+
+import (
+	"github.com/mileusna/useragent"
+)
+
+// ParseUserAgent classifies a User-Agent header into a Client
+func ParseUserAgent(header string) Client {
+	ua := useragent.Parse(header)
+	client := Client{OS: OSOther, Device: DeviceOther, Bot: ua.Bot}
+	switch ua.OS {
+	case useragent.Android:
+		client.OS = OSAndroid
+	case useragent.IOS:
+		client.OS = OSIOS
+	case useragent.Windows, useragent.WindowsPhone:
+		client.OS = OSWindows
+	case useragent.MacOS:
+		client.OS = OSMacOS
+	case useragent.Linux:
+		client.OS = OSLinux
+	case useragent.ChromeOS, useragent.CrOS:
+		client.OS = OSChromeOS
+	}
+	switch {
+	case ua.Tablet:
+		client.Device = DeviceTablet
+	case ua.Mobile:
+		client.Device = DeviceMobile
+	case ua.Desktop:
+		client.Device = DeviceDesktop
+	}
+	return client
+}
@@ -0,0 +1,85 @@
+package targeting
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+)
+
+// Variant is one of several weighted destinations of a link
+type Variant struct {
+	Name   string `json:"name" msgpack:"n"`
+	URL    string `json:"url" msgpack:"u"`
+	Weight int    `json:"weight" msgpack:"w"`
+}
+
+// Variants split the traffic of a link in proportion to their weights
+type Variants []Variant
+
+// Validate checks that every variant is named uniquely, weighted and has a usable destination
+func (vs Variants) Validate() error {
+	names := map[string]bool{}
+	for i, variant := range vs {
+		if variant.Name == "" {
+			return fmt.Errorf("variant %d has no name", i)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("variant name %q is used more than once", variant.Name)
+		}
+		names[variant.Name] = true
+		if variant.Weight <= 0 {
+			return fmt.Errorf("variant %q must have a positive weight", variant.Name)
+		}
+		if _, err := url.ParseRequestURI(variant.URL); err != nil {
+			return fmt.Errorf("invalid variant url %q: %v", variant.URL, err)
+		}
+	}
+	return nil
+}
+
+// Find returns the variant with the given name
+func (vs Variants) Find(name string) (Variant, bool) {
+	for _, variant := range vs {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+// Pick deterministically chooses a variant for key by weight, so the same key
+// always gets the same variant while the variants are unchanged
+func (vs Variants) Pick(key string) Variant {
+	total := 0
+	for _, variant := range vs {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return Variant{}
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	point := int(hash.Sum64() % uint64(total))
+	for _, variant := range vs {
+		if point < variant.Weight {
+			return variant
+		}
+		point -= variant.Weight
+	}
+	return vs[len(vs)-1]
+}
+
+// Value stores the variants as JSON
+func (vs Variants) Value() (driver.Value, error) {
+	if len(vs) == 0 {
+		return "", nil
+	}
+	return jsonValue(vs)
+}
+
+// Scan reads variants stored as JSON
+func (vs *Variants) Scan(src interface{}) error {
+	*vs = nil
+	return scanJSON(src, vs)
+}
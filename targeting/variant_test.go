@@ -0,0 +1,47 @@
+package targeting
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantsPick(t *testing.T) {
+	assert := assert.New(t)
+	variants := Variants{
+		{Name: "a", URL: "https://www.example.com/a", Weight: 3},
+		{Name: "b", URL: "https://www.example.com/b", Weight: 1},
+	}
+
+	assert.Equal(variants.Pick("client-1"), variants.Pick("client-1"), "sticky for the same key")
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[variants.Pick(fmt.Sprintf("client-%d", i)).Name]++
+	}
+	assert.InDelta(3000, counts["a"], 200)
+	assert.InDelta(1000, counts["b"], 200)
+}
+
+func TestVariantsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Variants{{Name: "a", URL: "https://www.example.com", Weight: 1}}.Validate())
+	assert.Error(Variants{{URL: "https://www.example.com", Weight: 1}}.Validate())
+	assert.Error(Variants{{Name: "a", URL: "https://www.example.com", Weight: 0}}.Validate())
+	assert.Error(Variants{{Name: "a", URL: "https://www.example.com", Weight: 1}, {Name: "a", URL: "https://www.example.org", Weight: 1}}.Validate())
+	assert.Error(Variants{{Name: "a", URL: "example", Weight: 1}}.Validate())
+}
+
+func TestVariantsScan(t *testing.T) {
+	assert := assert.New(t)
+
+	variants := Variants{{Name: "a", URL: "https://www.example.com", Weight: 1}}
+	value, err := variants.Value()
+	assert.NoError(err)
+
+	var scanned Variants
+	assert.NoError(scanned.Scan(value))
+	assert.Equal(variants, scanned)
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache wraps a cache.Cache and records a span for every operation
+type Cache struct {
+	cache.Cache
+}
+
+// InstrumentCache wraps c with tracing
+func InstrumentCache(c cache.Cache) *Cache {
+	return &Cache{c}
+}
+
+func startCacheSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "cache."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationName(operation)))
+}
+
+// SetURL traces Cache.SetURL
+func (c *Cache) SetURL(ctx context.Context, shortener *cache.Shortener, ttl time.Duration) (err error) {
+	ctx, span := startCacheSpan(ctx, "SetURL")
+	defer func() { end(span, err) }()
+	return c.Cache.SetURL(ctx, shortener, ttl)
+}
+
+// GetURL traces Cache.GetURL, a miss is recorded as an attribute rather than an error
+func (c *Cache) GetURL(ctx context.Context, token string) (*cache.Shortener, error) {
+	ctx, span := startCacheSpan(ctx, "GetURL")
+	shortener, err := c.Cache.GetURL(ctx, token)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	if err == cache.ErrNotFound {
+		end(span, nil)
+	} else {
+		end(span, err)
+	}
+	return shortener, err
+}
+
+// DeleteURL traces Cache.DeleteURL
+func (c *Cache) DeleteURL(ctx context.Context, token string) (err error) {
+	ctx, span := startCacheSpan(ctx, "DeleteURL")
+	defer func() { end(span, err) }()
+	return c.Cache.DeleteURL(ctx, token)
+}
+
+// Ping traces Cache.Ping
+func (c *Cache) Ping(ctx context.Context) (err error) {
+	ctx, span := startCacheSpan(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return c.Cache.Ping(ctx)
+}
@@ -0,0 +1,306 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/derek-elliott/url-shortener/db"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store wraps a db.Store and records a span for every operation
+type Store struct {
+	db.Store
+}
+
+// InstrumentStore wraps store with tracing
+func InstrumentStore(store db.Store) *Store {
+	return &Store{store}
+}
+
+func startStoreSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "db."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)))
+}
+
+// GetShortURL traces Store.GetShortURL
+func (s *Store) GetShortURL(ctx context.Context, token string) (shortURL *db.ShortURL, err error) {
+	ctx, span := startStoreSpan(ctx, "GetShortURL")
+	defer func() { end(span, err) }()
+	return s.Store.GetShortURL(ctx, token)
+}
+
+// GetAllURLTokens traces Store.GetAllURLTokens
+func (s *Store) GetAllURLTokens(ctx context.Context) (tokens []string, err error) {
+	ctx, span := startStoreSpan(ctx, "GetAllURLTokens")
+	defer func() { end(span, err) }()
+	return s.Store.GetAllURLTokens(ctx)
+}
+
+// CreateShortURL traces Store.CreateShortURL
+func (s *Store) CreateShortURL(ctx context.Context, shortURL *db.ShortURL, claim *db.QuotaClaim, events db.Events) (err error) {
+	ctx, span := startStoreSpan(ctx, "CreateShortURL")
+	defer func() { end(span, err) }()
+	return s.Store.CreateShortURL(ctx, shortURL, claim, events)
+}
+
+// UpdateShortURL traces Store.UpdateShortURL
+func (s *Store) UpdateShortURL(ctx context.Context, shortURL *db.ShortURL) (err error) {
+	ctx, span := startStoreSpan(ctx, "UpdateShortURL")
+	defer func() { end(span, err) }()
+	return s.Store.UpdateShortURL(ctx, shortURL)
+}
+
+// IncrementRedirects traces Store.IncrementRedirects
+func (s *Store) IncrementRedirects(ctx context.Context, token string, events db.Events) (redirects int, err error) {
+	ctx, span := startStoreSpan(ctx, "IncrementRedirects")
+	defer func() { end(span, err) }()
+	return s.Store.IncrementRedirects(ctx, token, events)
+}
+
+// UpdateLink traces Store.UpdateLink
+func (s *Store) UpdateLink(ctx context.Context, token string, update *db.LinkUpdate, events db.Events) (shortURL *db.ShortURL, err error) {
+	ctx, span := startStoreSpan(ctx, "UpdateLink")
+	defer func() { end(span, err) }()
+	return s.Store.UpdateLink(ctx, token, update, events)
+}
+
+// SetStatus traces Store.SetStatus
+func (s *Store) SetStatus(ctx context.Context, token string, change *db.StatusChange, events db.Events) (shortURL *db.ShortURL, err error) {
+	ctx, span := startStoreSpan(ctx, "SetStatus")
+	defer func() { end(span, err) }()
+	return s.Store.SetStatus(ctx, token, change, events)
+}
+
+// DeleteShortURL traces Store.DeleteShortURL
+func (s *Store) DeleteShortURL(ctx context.Context, token string, events db.Events) (err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteShortURL")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteShortURL(ctx, token, events)
+}
+
+// TokenExists traces Store.TokenExists
+func (s *Store) TokenExists(ctx context.Context, token string) (exists bool, err error) {
+	ctx, span := startStoreSpan(ctx, "TokenExists")
+	defer func() { end(span, err) }()
+	return s.Store.TokenExists(ctx, token)
+}
+
+// ListDeleted traces Store.ListDeleted
+func (s *Store) ListDeleted(ctx context.Context, limit, offset int) (shortURLs db.ShortURLS, err error) {
+	ctx, span := startStoreSpan(ctx, "ListDeleted")
+	defer func() { end(span, err) }()
+	return s.Store.ListDeleted(ctx, limit, offset)
+}
+
+// RestoreShortURLs traces Store.RestoreShortURLs
+func (s *Store) RestoreShortURLs(ctx context.Context, tokens []string, events db.Events) (restored []string, err error) {
+	ctx, span := startStoreSpan(ctx, "RestoreShortURLs")
+	defer func() { end(span, err) }()
+	return s.Store.RestoreShortURLs(ctx, tokens, events)
+}
+
+// PurgeDeleted traces Store.PurgeDeleted
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time, limit int) (tokens []string, err error) {
+	ctx, span := startStoreSpan(ctx, "PurgeDeleted")
+	defer func() { end(span, err) }()
+	return s.Store.PurgeDeleted(ctx, before, limit)
+}
+
+// MatchLinks traces Store.MatchLinks
+func (s *Store) MatchLinks(ctx context.Context, filter *db.LinkFilter, sample int) (match *db.LinkMatch, err error) {
+	ctx, span := startStoreSpan(ctx, "MatchLinks")
+	defer func() { end(span, err) }()
+	return s.Store.MatchLinks(ctx, filter, sample)
+}
+
+// DeleteLinks traces Store.DeleteLinks
+func (s *Store) DeleteLinks(ctx context.Context, filter *db.LinkFilter, digest string, events db.Events) (tokens []string, err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteLinks")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteLinks(ctx, filter, digest, events)
+}
+
+// RecordAudit traces Store.RecordAudit
+func (s *Store) RecordAudit(ctx context.Context, entry *db.AuditEntry) (err error) {
+	ctx, span := startStoreSpan(ctx, "RecordAudit")
+	defer func() { end(span, err) }()
+	return s.Store.RecordAudit(ctx, entry)
+}
+
+// ListAudit traces Store.ListAudit
+func (s *Store) ListAudit(ctx context.Context, filter *db.AuditFilter) (entries []db.AuditEntry, err error) {
+	ctx, span := startStoreSpan(ctx, "ListAudit")
+	defer func() { end(span, err) }()
+	return s.Store.ListAudit(ctx, filter)
+}
+
+// CreateWebhook traces Store.CreateWebhook
+func (s *Store) CreateWebhook(ctx context.Context, webhook *db.Webhook) (err error) {
+	ctx, span := startStoreSpan(ctx, "CreateWebhook")
+	defer func() { end(span, err) }()
+	return s.Store.CreateWebhook(ctx, webhook)
+}
+
+// GetWebhook traces Store.GetWebhook
+func (s *Store) GetWebhook(ctx context.Context, id uint) (webhook *db.Webhook, err error) {
+	ctx, span := startStoreSpan(ctx, "GetWebhook")
+	defer func() { end(span, err) }()
+	return s.Store.GetWebhook(ctx, id)
+}
+
+// ListWebhooks traces Store.ListWebhooks
+func (s *Store) ListWebhooks(ctx context.Context) (webhooks []db.Webhook, err error) {
+	ctx, span := startStoreSpan(ctx, "ListWebhooks")
+	defer func() { end(span, err) }()
+	return s.Store.ListWebhooks(ctx)
+}
+
+// DeleteWebhook traces Store.DeleteWebhook
+func (s *Store) DeleteWebhook(ctx context.Context, id uint) (err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteWebhook")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteWebhook(ctx, id)
+}
+
+// ClaimDeliveries traces Store.ClaimDeliveries
+func (s *Store) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) (deliveries []db.WebhookDelivery, err error) {
+	ctx, span := startStoreSpan(ctx, "ClaimDeliveries")
+	defer func() { end(span, err) }()
+	return s.Store.ClaimDeliveries(ctx, now, until, limit)
+}
+
+// UpdateDelivery traces Store.UpdateDelivery
+func (s *Store) UpdateDelivery(ctx context.Context, delivery *db.WebhookDelivery) (err error) {
+	ctx, span := startStoreSpan(ctx, "UpdateDelivery")
+	defer func() { end(span, err) }()
+	return s.Store.UpdateDelivery(ctx, delivery)
+}
+
+// ListDeliveries traces Store.ListDeliveries
+func (s *Store) ListDeliveries(ctx context.Context, webhookID uint, limit int) (deliveries []db.WebhookDelivery, err error) {
+	ctx, span := startStoreSpan(ctx, "ListDeliveries")
+	defer func() { end(span, err) }()
+	return s.Store.ListDeliveries(ctx, webhookID, limit)
+}
+
+// DeleteExpired traces Store.DeleteExpired
+func (s *Store) DeleteExpired(ctx context.Context, before time.Time, limit int, events db.Events) (tokens []string, err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteExpired")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteExpired(ctx, before, limit, events)
+}
+
+// TokenExpired traces Store.TokenExpired
+func (s *Store) TokenExpired(ctx context.Context, token string) (expired bool, err error) {
+	ctx, span := startStoreSpan(ctx, "TokenExpired")
+	defer func() { end(span, err) }()
+	return s.Store.TokenExpired(ctx, token)
+}
+
+// PurgeTombstones traces Store.PurgeTombstones
+func (s *Store) PurgeTombstones(ctx context.Context, before time.Time) (count int, err error) {
+	ctx, span := startStoreSpan(ctx, "PurgeTombstones")
+	defer func() { end(span, err) }()
+	return s.Store.PurgeTombstones(ctx, before)
+}
+
+// CollectStats traces Store.CollectStats
+func (s *Store) CollectStats(ctx context.Context, filter *db.LinkFilter) (stats *db.Stats, err error) {
+	ctx, span := startStoreSpan(ctx, "CollectStats")
+	defer func() { end(span, err) }()
+	return s.Store.CollectStats(ctx, filter)
+}
+
+// ListLinks traces Store.ListLinks
+func (s *Store) ListLinks(ctx context.Context, filter *db.LinkFilter, limit, offset int) (shortURLs db.ShortURLS, err error) {
+	ctx, span := startStoreSpan(ctx, "ListLinks")
+	defer func() { end(span, err) }()
+	return s.Store.ListLinks(ctx, filter, limit, offset)
+}
+
+// ListTags traces Store.ListTags
+func (s *Store) ListTags(ctx context.Context) (tags []db.TagCount, err error) {
+	ctx, span := startStoreSpan(ctx, "ListTags")
+	defer func() { end(span, err) }()
+	return s.Store.ListTags(ctx)
+}
+
+// RenameTag traces Store.RenameTag
+func (s *Store) RenameTag(ctx context.Context, from, to string) (err error) {
+	ctx, span := startStoreSpan(ctx, "RenameTag")
+	defer func() { end(span, err) }()
+	return s.Store.RenameTag(ctx, from, to)
+}
+
+// DeleteTag traces Store.DeleteTag
+func (s *Store) DeleteTag(ctx context.Context, name string) (err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteTag")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteTag(ctx, name)
+}
+
+// ListFolders traces Store.ListFolders
+func (s *Store) ListFolders(ctx context.Context) (folders []db.FolderCount, err error) {
+	ctx, span := startStoreSpan(ctx, "ListFolders")
+	defer func() { end(span, err) }()
+	return s.Store.ListFolders(ctx)
+}
+
+// ListInterstitialDomains traces Store.ListInterstitialDomains
+func (s *Store) ListInterstitialDomains(ctx context.Context) (domains []db.InterstitialDomain, err error) {
+	ctx, span := startStoreSpan(ctx, "ListInterstitialDomains")
+	defer func() { end(span, err) }()
+	return s.Store.ListInterstitialDomains(ctx)
+}
+
+// AddInterstitialDomain traces Store.AddInterstitialDomain
+func (s *Store) AddInterstitialDomain(ctx context.Context, domain *db.InterstitialDomain) (err error) {
+	ctx, span := startStoreSpan(ctx, "AddInterstitialDomain")
+	defer func() { end(span, err) }()
+	return s.Store.AddInterstitialDomain(ctx, domain)
+}
+
+// DeleteInterstitialDomain traces Store.DeleteInterstitialDomain
+func (s *Store) DeleteInterstitialDomain(ctx context.Context, domain string) (err error) {
+	ctx, span := startStoreSpan(ctx, "DeleteInterstitialDomain")
+	defer func() { end(span, err) }()
+	return s.Store.DeleteInterstitialDomain(ctx, domain)
+}
+
+// IncrementClicks traces Store.IncrementClicks
+func (s *Store) IncrementClicks(ctx context.Context, token, dimension, value string) (err error) {
+	ctx, span := startStoreSpan(ctx, "IncrementClicks")
+	defer func() { end(span, err) }()
+	return s.Store.IncrementClicks(ctx, token, dimension, value)
+}
+
+// GetClicks traces Store.GetClicks
+func (s *Store) GetClicks(ctx context.Context, token string) (clicks map[string]map[string]int, err error) {
+	ctx, span := startStoreSpan(ctx, "GetClicks")
+	defer func() { end(span, err) }()
+	return s.Store.GetClicks(ctx, token)
+}
+
+// CountActiveLinks traces Store.CountActiveLinks
+func (s *Store) CountActiveLinks(ctx context.Context, owner string, now time.Time) (count int, err error) {
+	ctx, span := startStoreSpan(ctx, "CountActiveLinks")
+	defer func() { end(span, err) }()
+	return s.Store.CountActiveLinks(ctx, owner, now)
+}
+
+// GetCreations traces Store.GetCreations
+func (s *Store) GetCreations(ctx context.Context, owner string, periodStart time.Time) (count int, err error) {
+	ctx, span := startStoreSpan(ctx, "GetCreations")
+	defer func() { end(span, err) }()
+	return s.Store.GetCreations(ctx, owner, periodStart)
+}
+
+// Ping traces Store.Ping
+func (s *Store) Ping(ctx context.Context) (err error) {
+	ctx, span := startStoreSpan(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return s.Store.Ping(ctx)
+}
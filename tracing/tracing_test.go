@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/derek-elliott/url-shortener/cache"
+	"github.com/derek-elliott/url-shortener/db"
+	"github.com/derek-elliott/url-shortener/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupRecorder() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestStoreSpan(t *testing.T) {
+	assert := assert.New(t)
+	recorder := setupRecorder()
+
+	testDB := &mocks.Store{}
+	testDB.On("GetShortURL", mock.Anything, "testurl").Return(&db.ShortURL{}, nil)
+	store := InstrumentStore(testDB)
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	_, err := store.GetShortURL(ctx, "testurl")
+	parent.End()
+
+	assert.NoError(err)
+	spans := recorder.Ended()
+	assert.Len(spans, 2)
+	assert.Equal("db.GetShortURL", spans[0].Name())
+	assert.Equal(parent.SpanContext().SpanID(), spans[0].Parent().SpanID(), "store span is a child of the caller")
+}
+
+func TestStoreErrorSpan(t *testing.T) {
+	assert := assert.New(t)
+	recorder := setupRecorder()
+
+	testDB := &mocks.Store{}
+	testDB.On("DeleteShortURL", mock.Anything, "testurl", mock.Anything).Return(errors.New("test db error"))
+	store := InstrumentStore(testDB)
+
+	err := store.DeleteShortURL(context.Background(), "testurl", nil)
+
+	assert.Error(err)
+	spans := recorder.Ended()
+	assert.Len(spans, 1)
+	assert.Equal(codes.Error, spans[0].Status().Code)
+}
+
+func TestCacheMissSpan(t *testing.T) {
+	assert := assert.New(t)
+	recorder := setupRecorder()
+
+	testCache := &mocks.Cache{}
+	testCache.On("GetURL", mock.Anything, "testurl").Return(nil, cache.ErrNotFound)
+	c := InstrumentCache(testCache)
+
+	_, err := c.GetURL(context.Background(), "testurl")
+
+	assert.Equal(cache.ErrNotFound, err)
+	spans := recorder.Ended()
+	assert.Len(spans, 1)
+	assert.Equal("cache.GetURL", spans[0].Name())
+	assert.NotEqual(codes.Error, spans[0].Status().Code, "a miss is not an error")
+}
+
+func TestStdoutExporter(t *testing.T) {
+	assert := assert.New(t)
+	var out bytes.Buffer
+
+	shutdown, err := Init(context.Background(), Config{Exporter: "stdout", Writer: &out})
+	assert.NoError(err)
+
+	_, span := Tracer().Start(context.Background(), "test-span")
+	span.End()
+	assert.NoError(shutdown(context.Background()))
+
+	assert.Contains(out.String(), "test-span")
+}
+
+func TestUnknownExporter(t *testing.T) {
+	_, err := Init(context.Background(), Config{Exporter: "carrier-pigeon"})
+	assert.Error(t, err)
+}
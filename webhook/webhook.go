@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event types sent to webhook subscribers
+const (
+	LinkCreated   = "link.created"
+	LinkUpdated   = "link.updated"
+	LinkDeleted   = "link.deleted"
+	LinkRestored  = "link.restored"
+	LinkExpired   = "link.expired"
+	LinkMilestone = "link.milestone"
+)
+
+// Headers set on every delivery
+const (
+	EventHeader     = "X-Snip-Event"
+	DeliveryHeader  = "X-Snip-Delivery"
+	TimestampHeader = "X-Snip-Timestamp"
+	SignatureHeader = "X-Snip-Signature"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is given up on
+	MaxAttempts = 10
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+var eventTypes = map[string]bool{
+	LinkCreated:   true,
+	LinkUpdated:   true,
+	LinkDeleted:   true,
+	LinkRestored:  true,
+	LinkExpired:   true,
+	LinkMilestone: true,
+}
+
+// ValidEvent reports whether event is a known event type
+func ValidEvent(event string) bool {
+	return eventTypes[event]
+}
+
+// Event is the body of a delivery
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Token     string      `json:"token,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Request describes a single attempt to deliver an event
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID uint
+	Payload    []byte
+}
+
+// Sign computes the signature of a delivery, the hex HMAC-SHA256 of the
+// timestamp and body joined by a dot, keyed with the subscription secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts the signed payload and returns the response status code. Any
+// status outside 2xx is an error.
+func Deliver(ctx context.Context, client *http.Client, req *Request, now time.Time) (int, error) {
+	timestamp := now.Unix()
+	httpReq, err := http.NewRequest(http.MethodPost, req.URL, bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(EventHeader, req.Event)
+	httpReq.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(req.DeliveryID), 10))
+	httpReq.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, timestamp, req.Payload))
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns how long to wait before the next attempt after the given
+// number of failed attempts, doubling from 30 seconds up to 6 hours
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := baseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	assert := assert.New(t)
+
+	signature := Sign("secret", 1700000000, []byte(`{"type":"link.created"}`))
+	assert.Equal("sha256=", signature[:7])
+	assert.Len(signature, 7+64)
+	assert.Equal(signature, Sign("secret", 1700000000, []byte(`{"type":"link.created"}`)))
+	assert.NotEqual(signature, Sign("other", 1700000000, []byte(`{"type":"link.created"}`)))
+	assert.NotEqual(signature, Sign("secret", 1700000001, []byte(`{"type":"link.created"}`)))
+}
+
+func TestDeliver(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"type":"link.deleted"}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		assert.Equal(LinkDeleted, r.Header.Get(EventHeader))
+		assert.Equal("42", r.Header.Get(DeliveryHeader))
+		assert.Equal(now.Unix(), timestamp)
+		assert.Equal(Sign("secret", timestamp, body), r.Header.Get(SignatureHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := Deliver(context.Background(), server.Client(), &Request{
+		URL:        server.URL,
+		Secret:     "secret",
+		Event:      LinkDeleted,
+		DeliveryID: 42,
+		Payload:    payload,
+	}, now)
+	assert.NoError(err)
+	assert.Equal(http.StatusNoContent, status)
+}
+
+func TestFailedDeliver(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	status, err := Deliver(context.Background(), server.Client(), &Request{URL: server.URL, Payload: []byte("{}")}, time.Now())
+	assert.Error(err)
+	assert.Equal(http.StatusServiceUnavailable, status)
+}
+
+func TestClientRefusesInternalAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := Deliver(context.Background(), NewClient(time.Second), &Request{URL: server.URL, Payload: []byte("{}")}, time.Now())
+	assert.Error(err)
+	assert.Contains(err.Error(), ErrForbiddenAddress.Error())
+	assert.Equal(0, status)
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/", http.StatusFound)
+	}))
+	defer server.Close()
+	client := server.Client()
+	client.CheckRedirect = NewClient(time.Second).CheckRedirect
+
+	status, err := Deliver(context.Background(), client, &Request{URL: server.URL, Payload: []byte("{}")}, time.Now())
+	assert.Error(err)
+	assert.Equal(http.StatusFound, status)
+}
+
+func TestForbidden(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::ffff:127.0.0.1"} {
+		assert.True(Forbidden(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::1"} {
+		assert.False(Forbidden(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(30*time.Second, Backoff(0))
+	assert.Equal(30*time.Second, Backoff(1))
+	assert.Equal(time.Minute, Backoff(2))
+	assert.Equal(4*time.Minute, Backoff(4))
+	assert.Equal(6*time.Hour, Backoff(20))
+}